@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API key scopes. Send endpoints are never reachable with an API key.
+const (
+	ScopeReceiveCreate = "receive:create"
+	ScopeTransfersRead = "transfers:read"
+	ScopeBalancesRead  = "balances:read"
+)
+
+// APIKeyPrefix starts every API key handed out to operators.
+const APIKeyPrefix = "tajfi_"
+
+var (
+	ErrAPIKeyInvalid = errors.New("invalid API key")
+	ErrUnknownScope  = errors.New("unknown scope")
+)
+
+var validScopes = map[string]bool{
+	ScopeReceiveCreate: true,
+	ScopeTransfersRead: true,
+	ScopeBalancesRead:  true,
+}
+
+// APIKey is an operator-issued credential acting on behalf of PublicKey.
+// Only the SHA-256 of the secret part is stored.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Label      string     `json:"label"`
+	PublicKey  string     `json:"public_key"`
+	Scopes     []string   `json:"scopes"`
+	SecretHash string     `json:"secret_hash,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the key was granted scope.
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyStore keeps API keys in memory and, when path is set, persists them
+// to a JSON file.
+type APIKeyStore struct {
+	mu   sync.RWMutex
+	path string
+	keys map[string]*APIKey
+}
+
+// LoadAPIKeyStore opens the store at path, which may not exist yet. An empty
+// path keeps keys in memory only.
+func LoadAPIKeyStore(path string) (*APIKeyStore, error) {
+	s := &APIKeyStore{path: path, keys: make(map[string]*APIKey)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []*APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, key := range keys {
+		s.keys[key.ID] = key
+	}
+	return s, nil
+}
+
+// Create issues a new key for pubKey and returns it together with the
+// plaintext secret, which is not retrievable afterwards.
+func (s *APIKeyStore) Create(label, pubKey string, scopes []string) (*APIKey, string, error) {
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return nil, "", fmt.Errorf("%w: %s", ErrUnknownScope, scope)
+		}
+	}
+
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", err
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := hex.EncodeToString(secretBytes)
+
+	key := &APIKey{
+		ID:         id,
+		Label:      label,
+		PublicKey:  pubKey,
+		Scopes:     scopes,
+		SecretHash: hashToken(secret),
+		CreatedAt:  time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[id] = key
+	if err := s.saveLocked(); err != nil {
+		delete(s.keys, id)
+		return nil, "", err
+	}
+
+	return key, APIKeyPrefix + id + "_" + secret, nil
+}
+
+// Authenticate resolves a plaintext API key to its unrevoked record.
+func (s *APIKeyStore) Authenticate(plaintext string) (*APIKey, error) {
+	parts := strings.Split(strings.TrimPrefix(plaintext, APIKeyPrefix), "_")
+	if !strings.HasPrefix(plaintext, APIKeyPrefix) || len(parts) != 2 {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[parts[0]]
+	if !ok || key.RevokedAt != nil {
+		return nil, ErrAPIKeyInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(parts[1])), []byte(key.SecretHash)) != 1 {
+		return nil, ErrAPIKeyInvalid
+	}
+	return key, nil
+}
+
+// List returns all keys, without their secret hashes, oldest first.
+func (s *APIKeyStore) List() []APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		k := *key
+		k.SecretHash = ""
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// Revoke disables the key with the given ID.
+func (s *APIKeyStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyInvalid
+	}
+	if key.RevokedAt == nil {
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+	}
+	return s.saveLocked()
+}
+
+// saveLocked writes the store to disk. Callers must hold s.mu.
+func (s *APIKeyStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	keys := make([]*APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write API keys: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
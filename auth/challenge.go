@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrChallengeNotFound = errors.New("challenge not found")
+	ErrChallengeExpired  = errors.New("challenge expired")
+	ErrChallengeReplayed = errors.New("challenge already used")
+	ErrChallengeForeign  = errors.New("challenge was issued for a different public key")
+	ErrTooManyChallenges = errors.New("too many outstanding challenges")
+)
+
+// MaxChallengesPerKey is how many unexpired, unused challenges a single
+// public key may hold at once.
+const MaxChallengesPerKey = 5
+
+// Challenge is a single-use login nonce bound to a public key.
+type Challenge struct {
+	Challenge string    `json:"challenge"`
+	PublicKey string    `json:"public_key"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	used bool
+}
+
+// ChallengeStore issues and redeems login challenges. Redeemed and expired
+// challenges are kept around for one extra TTL so replays can be told apart
+// from unknown challenges. Challenges are issued without authentication, so
+// the store holds at most maxSize of them, unless it is 0, and
+// MaxChallengesPerKey outstanding ones per public key.
+type ChallengeStore struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxSize    int
+	challenges map[string]*Challenge
+}
+
+func NewChallengeStore(ttl time.Duration, maxSize int) *ChallengeStore {
+	return &ChallengeStore{
+		ttl:        ttl,
+		maxSize:    maxSize,
+		challenges: make(map[string]*Challenge),
+	}
+}
+
+// Issue creates a new challenge for the given x-only public key. It fails
+// with ErrTooManyChallenges when the key or the store is at its limit.
+func (s *ChallengeStore) Issue(pubKey string) (*Challenge, error) {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	now := time.Now()
+	challenge := &Challenge{
+		Challenge: fmt.Sprintf("tajfi-login:%s:%s", pubKey, hex.EncodeToString(nonce)),
+		PublicKey: pubKey,
+		ExpiresAt: now.Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(now)
+	if s.maxSize > 0 && len(s.challenges) >= s.maxSize {
+		return nil, ErrTooManyChallenges
+	}
+	outstanding := 0
+	for _, c := range s.challenges {
+		if c.PublicKey == pubKey && !c.used && now.Before(c.ExpiresAt) {
+			outstanding++
+		}
+	}
+	if outstanding >= MaxChallengesPerKey {
+		return nil, ErrTooManyChallenges
+	}
+	s.challenges[challenge.Challenge] = challenge
+
+	return challenge, nil
+}
+
+// Redeem marks the challenge as used if it is known, unexpired, unused and
+// bound to pubKey.
+func (s *ChallengeStore) Redeem(challenge, pubKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.challenges[challenge]
+	if !ok {
+		return ErrChallengeNotFound
+	}
+	if c.PublicKey != pubKey {
+		return ErrChallengeForeign
+	}
+	if c.used {
+		return ErrChallengeReplayed
+	}
+	if time.Now().After(c.ExpiresAt) {
+		return ErrChallengeExpired
+	}
+
+	c.used = true
+	return nil
+}
+
+// RunPrune drops stale challenges every interval, so the store shrinks
+// without waiting for the next Issue. It blocks forever and is meant to be
+// run in a goroutine.
+func (s *ChallengeStore) RunPrune(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		s.mu.Lock()
+		s.prune(now)
+		s.mu.Unlock()
+	}
+}
+
+// prune drops challenges that expired more than one TTL ago. Callers must
+// hold s.mu.
+func (s *ChallengeStore) prune(now time.Time) {
+	for key, c := range s.challenges {
+		if now.After(c.ExpiresAt.Add(s.ttl)) {
+			delete(s.challenges, key)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is a single asymmetric JWT key. Keys loaded from a public key
+// file can only verify.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// KeySet holds the keys used to sign and verify access tokens. Keys are
+// loaded from PEM files in a directory, the file name (without extension)
+// being the key ID. When no directory is configured the set falls back to
+// HS256 with the shared JWT secret.
+type KeySet struct {
+	keys       map[string]*signingKey
+	signing    *signingKey
+	hmacSecret []byte
+}
+
+// JWK is the public part of a key as served by the JWKS endpoint.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LoadKeySet reads every *.pem file in dir. PKCS#8 private keys can sign and
+// verify, PKIX public keys can only verify, which is how retired keys are
+// kept around until the tokens they signed expire. The signing key is
+// signingKID if set, otherwise the private key with the greatest ID.
+func LoadKeySet(dir, signingKID, hmacSecret string) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*signingKey)}
+	if dir == "" {
+		if hmacSecret == "" {
+			return nil, errors.New("either JWTKeysDir or JWTSecret must be set")
+		}
+		ks.hmacSecret = []byte(hmacSecret)
+		return ks, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		key, err := loadKeyFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", file, err)
+		}
+		ks.keys[key.kid] = key
+
+		if key.private == nil {
+			continue
+		}
+		if signingKID == "" || key.kid == signingKID {
+			ks.signing = key
+		}
+	}
+
+	if ks.signing == nil {
+		return nil, fmt.Errorf("no signing key found in %s", dir)
+	}
+	return ks, nil
+}
+
+// Sign signs claims with the current signing key, setting the kid header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.kid
+	return token.SignedString(ks.signing.private)
+}
+
+// Keyfunc resolves the verification key for token by its kid header.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if ks.signing == nil {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return ks.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown key id")
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("invalid signing method")
+	}
+	return key.public, nil
+}
+
+// JWKS returns the public keys other services can verify tokens with.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	for _, kid := range kids {
+		key := ks.keys[kid]
+		jwk := JWK{Kid: kid, Alg: key.method.Alg(), Use: "sig"}
+
+		switch pub := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		case *ecdsa.PublicKey:
+			jwk.Kty = "EC"
+			jwk.Crv = "P-256"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, 32)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, 32)))
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+// loadKeyFile parses an Ed25519 or P-256 key from a PEM file.
+func loadKeyFile(file string) (*signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &signingKey{
+		kid: strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key")
+		}
+		key.private = private
+		key.public = signer.Public()
+	case "EC PRIVATE KEY":
+		private, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.private = private
+		key.public = &private.PublicKey
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.public = public
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	switch pub := key.public.(type) {
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ECDSA keys are supported")
+		}
+		key.method = jwt.SigningMethodES256
+	default:
+		return nil, errors.New("only Ed25519 and P-256 keys are supported")
+	}
+
+	return key, nil
+}
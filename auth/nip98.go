@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NIP98Kind is the Nostr event kind used for HTTP Auth (NIP-98).
+const NIP98Kind = 27235
+
+// NostrEvent is a signed Nostr event as defined by NIP-01.
+type NostrEvent struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// NIP98Request describes the HTTP request a NIP-98 event must be bound to.
+type NIP98Request struct {
+	Method string
+	URL    string
+	Body   []byte
+}
+
+// NIP98EventCache remembers the ids of accepted NIP-98 events until they
+// fall out of the window, so each event authenticates a single request.
+type NIP98EventCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewNIP98EventCache() *NIP98EventCache {
+	return &NIP98EventCache{seen: make(map[string]time.Time)}
+}
+
+// Remember records id as used until expiresAt. It returns false if id was
+// already recorded and has not expired.
+func (c *NIP98EventCache) Remember(id string, expiresAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for key, until := range c.seen {
+		if now.After(until) {
+			delete(c.seen, key)
+		}
+	}
+
+	id = strings.ToLower(id)
+	if _, ok := c.seen[id]; ok {
+		return false
+	}
+	c.seen[id] = expiresAt
+	return true
+}
+
+// ParseNIP98Event decodes the base64 encoded event of an
+// "Authorization: Nostr <event>" header.
+func ParseNIP98Event(encoded string) (*NostrEvent, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("event is not valid base64")
+	}
+
+	var event NostrEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, errors.New("event is not valid JSON")
+	}
+	return &event, nil
+}
+
+// VerifyNIP98Event checks that event is a correctly signed kind 27235 event
+// for req, created within window of now and not used before. Requests with
+// a body must commit to it with a payload tag. It returns the signer's
+// x-only public key.
+func VerifyNIP98Event(event *NostrEvent, req NIP98Request, window time.Duration, seen *NIP98EventCache) (string, error) {
+	if event.Kind != NIP98Kind {
+		return "", fmt.Errorf("event kind must be %d", NIP98Kind)
+	}
+
+	createdAt := time.Unix(event.CreatedAt, 0)
+	if age := time.Since(createdAt); age > window || age < -window {
+		return "", errors.New("event created_at is outside the allowed window")
+	}
+
+	if tag := event.tagValue("u"); tag != req.URL {
+		return "", errors.New("event u tag does not match request URL")
+	}
+	if tag := event.tagValue("method"); !strings.EqualFold(tag, req.Method) {
+		return "", errors.New("event method tag does not match request method")
+	}
+	tag := event.tagValue("payload")
+	if tag == "" && len(req.Body) > 0 {
+		return "", errors.New("event payload tag is required for requests with a body")
+	}
+	if tag != "" {
+		sum := sha256.Sum256(req.Body)
+		if !strings.EqualFold(tag, hex.EncodeToString(sum[:])) {
+			return "", errors.New("event payload tag does not match request body")
+		}
+	}
+
+	id, err := event.computeID()
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(id, event.ID) {
+		return "", errors.New("event id does not match its content")
+	}
+
+	digest, _ := hex.DecodeString(id)
+	if err := VerifyDigest(event.PubKey, digest, event.Sig); err != nil {
+		return "", err
+	}
+
+	if !seen.Remember(id, createdAt.Add(window)) {
+		return "", errors.New("event was already used")
+	}
+
+	return strings.ToLower(event.PubKey), nil
+}
+
+// tagValue returns the first value of the named tag, or "" if absent.
+func (e *NostrEvent) tagValue(name string) string {
+	for _, tag := range e.Tags {
+		if len(tag) > 1 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// computeID hashes the NIP-01 serialization of the event.
+func (e *NostrEvent) computeID() (string, error) {
+	tags := e.Tags
+	if tags == nil {
+		tags = [][]string{}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode([]interface{}{0, strings.ToLower(e.PubKey), e.CreatedAt, e.Kind, tags, e.Content}); err != nil {
+		return "", fmt.Errorf("failed to serialize event: %w", err)
+	}
+
+	sum := sha256.Sum256(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// NpubPrefix is the human readable part of NIP-19 public keys.
+const NpubPrefix = "npub"
+
+var ErrInvalidNpub = errors.New("invalid npub")
+
+// DecodeNpub decodes a NIP-19 npub into the hex x-only public key it holds.
+func DecodeNpub(npub string) (string, error) {
+	hrp, data, err := bech32.Decode(npub)
+	if err != nil || hrp != NpubPrefix {
+		return "", ErrInvalidNpub
+	}
+
+	key, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil || len(key) != 32 {
+		return "", ErrInvalidNpub
+	}
+	return hex.EncodeToString(key), nil
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// VerifyMessage checks a BIP-340 signature by the x-only pubKeyHex over the
+// SHA-256 digest of message.
+func VerifyMessage(pubKeyHex, message, signatureHex string) error {
+	digest := sha256.Sum256([]byte(message))
+	return VerifyDigest(pubKeyHex, digest[:], signatureHex)
+}
+
+// VerifyDigest checks a BIP-340 signature by the x-only pubKeyHex over a
+// 32-byte digest.
+func VerifyDigest(pubKeyHex string, digest []byte, signatureHex string) error {
+	pubKeyBytes, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		return errors.New("invalid public key hex")
+	}
+	pubKey, err := schnorr.ParsePubKey(pubKeyBytes)
+	if err != nil {
+		return errors.New("invalid public key")
+	}
+
+	sigBytes, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	if !sig.Verify(digest, pubKey) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrTokenInvalid        = errors.New("invalid token")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, all sessions for this login were revoked")
+)
+
+// TokenPair is returned to clients on login and on every refresh.
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// AccessClaims are the claims carried by an access token.
+type AccessClaims struct {
+	PublicKey string `json:"public_key"`
+	Family    string `json:"fam"`
+	jwt.RegisteredClaims
+}
+
+// tokenFamily groups every access and refresh token descending from a single
+// login, so that all of them can be revoked together.
+type tokenFamily struct {
+	publicKey string
+	revoked   bool
+	expiresAt time.Time
+	// access token IDs issued in this family, mapped to their expiry
+	accessTokens map[string]time.Time
+}
+
+type refreshToken struct {
+	family    string
+	expiresAt time.Time
+	used      bool
+}
+
+// TokenService issues short-lived access tokens and rotating refresh tokens
+// and keeps track of revocations. State is held in memory.
+type TokenService struct {
+	keys       *KeySet
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	mu            sync.Mutex
+	families      map[string]*tokenFamily
+	refreshTokens map[string]*refreshToken // keyed by SHA-256 of the token
+	revoked       map[string]time.Time     // access token ID -> expiry
+}
+
+func NewTokenService(keys *KeySet, accessTTL, refreshTTL time.Duration) *TokenService {
+	return &TokenService{
+		keys:          keys,
+		accessTTL:     accessTTL,
+		refreshTTL:    refreshTTL,
+		families:      make(map[string]*tokenFamily),
+		refreshTokens: make(map[string]*refreshToken),
+		revoked:       make(map[string]time.Time),
+	}
+}
+
+// Issue starts a new token family for pubKey.
+func (s *TokenService) Issue(pubKey string) (*TokenPair, error) {
+	familyID, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(time.Now())
+	s.families[familyID] = &tokenFamily{
+		publicKey:    pubKey,
+		accessTokens: make(map[string]time.Time),
+	}
+
+	return s.issueLocked(familyID)
+}
+
+// Refresh redeems a refresh token for a new token pair in the same family.
+// Presenting an already redeemed refresh token revokes the whole family.
+func (s *TokenService) Refresh(token string) (*TokenPair, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[hashToken(token)]
+	if !ok {
+		return nil, ErrRefreshTokenInvalid
+	}
+	family, ok := s.families[rt.family]
+	if !ok || family.revoked {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if rt.used {
+		s.revokeFamilyLocked(rt.family)
+		return nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(rt.expiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	rt.used = true
+	return s.issueLocked(rt.family)
+}
+
+// Verify parses an access token and checks it has not been revoked.
+func (s *TokenService) Verify(tokenString string) (*AccessClaims, error) {
+	claims := new(AccessClaims)
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keys.Keyfunc)
+	if err != nil || !token.Valid {
+		return nil, ErrTokenInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, revoked := s.revoked[claims.ID]; revoked {
+		return nil, ErrTokenRevoked
+	}
+	if family, ok := s.families[claims.Family]; ok && family.revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// RevokeFamily revokes every access and refresh token issued in family.
+func (s *TokenService) RevokeFamily(family string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeFamilyLocked(family)
+}
+
+// issueLocked signs a new access token and mints a new refresh token in
+// family. Callers must hold s.mu.
+func (s *TokenService) issueLocked(familyID string) (*TokenPair, error) {
+	family := s.families[familyID]
+
+	jti, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	accessExpiry := now.Add(s.accessTTL)
+	refreshExpiry := now.Add(s.refreshTTL)
+
+	claims := AccessClaims{
+		PublicKey: family.publicKey,
+		Family:    familyID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   family.publicKey,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(accessExpiry),
+		},
+	}
+	signed, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	family.accessTokens[jti] = accessExpiry
+	family.expiresAt = refreshExpiry
+	s.refreshTokens[hashToken(refresh)] = &refreshToken{
+		family:    familyID,
+		expiresAt: refreshExpiry,
+	}
+
+	return &TokenPair{
+		AccessToken:      signed,
+		ExpiresAt:        accessExpiry,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: refreshExpiry,
+	}, nil
+}
+
+// revokeFamilyLocked marks family and all of its access tokens as revoked.
+// Callers must hold s.mu.
+func (s *TokenService) revokeFamilyLocked(familyID string) {
+	family, ok := s.families[familyID]
+	if !ok {
+		return
+	}
+	family.revoked = true
+	for jti, expiresAt := range family.accessTokens {
+		s.revoked[jti] = expiresAt
+	}
+}
+
+// prune forgets tokens and families that can no longer be presented.
+// Callers must hold s.mu.
+func (s *TokenService) prune(now time.Time) {
+	for jti, expiresAt := range s.revoked {
+		if now.After(expiresAt) {
+			delete(s.revoked, jti)
+		}
+	}
+	for hash, rt := range s.refreshTokens {
+		if now.After(rt.expiresAt) {
+			delete(s.refreshTokens, hash)
+		}
+	}
+	for id, family := range s.families {
+		if now.After(family.expiresAt) {
+			delete(s.families, id)
+		}
+	}
+}
+
+func randomID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random id: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
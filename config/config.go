@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -16,10 +17,56 @@ type Config struct {
 	LNDMacaroon  string `form:"LNDMacaroon"`
 	TapdMacaroon string `form:"TapdMacaroon"`
 
-	JWTSecret string `form:"JWTSecret"`
+	JWTSecret       string        `form:"JWTSecret"`
+	JWTKeysDir      string        `form:"JWTKeysDir"`
+	JWTSigningKeyID string        `form:"JWTSigningKeyID"`
+	AccessTokenTTL  time.Duration `form:"AccessTokenTTL"`
+	RefreshTokenTTL time.Duration `form:"RefreshTokenTTL"`
+	ChallengeTTL    time.Duration `form:"ChallengeTTL"`
+	// ChallengeMaxPending caps the login challenges held at once
+	ChallengeMaxPending int           `form:"ChallengeMaxPending"`
+	NIP98Window         time.Duration `form:"NIP98Window"`
+
+	AdminToken  string `form:"AdminToken"`
+	APIKeysFile string `form:"APIKeysFile"`
 
 	TaprootSigsDir string `form:"TaprootSigsDir"`
 
+	SendSessionTTL        time.Duration `form:"SendSessionTTL"`
+	SendSessionRetention  time.Duration `form:"SendSessionRetention"`
+	CoinSelectionStrategy string        `form:"CoinSelectionStrategy"`
+	IdempotencyKeyTTL     time.Duration `form:"IdempotencyKeyTTL"`
+
+	OperatorFeeScheduleFile string `form:"OperatorFeeScheduleFile"`
+	OperatorFeeLedgerFile   string `form:"OperatorFeeLedgerFile"`
+	PolicyFile              string `form:"PolicyFile"`
+	ContactsFile            string `form:"ContactsFile"`
+	ScriptKeysFile          string `form:"ScriptKeysFile"`
+
+	ProofDeliveryCheckInterval time.Duration `form:"ProofDeliveryCheckInterval"`
+	ProofDeliveryStuckAfter    time.Duration `form:"ProofDeliveryStuckAfter"`
+	ProofCourierAddr           string        `form:"ProofCourierAddr"`
+	ProofRedeliveryAuto        bool          `form:"ProofRedeliveryAuto"`
+	ProofRedeliveryMaxAttempts int           `form:"ProofRedeliveryMaxAttempts"`
+
+	AnchorBatchInterval time.Duration `form:"AnchorBatchInterval"`
+	AnchorBatchMaxSize  int           `form:"AnchorBatchMaxSize"`
+
+	FeeBumpCheckInterval time.Duration `form:"FeeBumpCheckInterval"`
+	FeeBumpStuckAfter    time.Duration `form:"FeeBumpStuckAfter"`
+	FeeBumpAuto          bool          `form:"FeeBumpAuto"`
+	FeeBumpMaxAttempts   int           `form:"FeeBumpMaxAttempts"`
+
+	// MuSig2Mode is "lnd" or "local" to make anchor internal keys MuSig2
+	// keys of the server and the user, empty to leave them to LND
+	MuSig2Mode      string `form:"MuSig2Mode"`
+	MuSig2LocalSeed string `form:"MuSig2LocalSeed"`
+	MuSig2KeysFile  string `form:"MuSig2KeysFile"`
+
+	MinFeeRate        uint64 `form:"MinFeeRate"` // sat/vB
+	MaxFeeRate        uint64 `form:"MaxFeeRate"` // sat/vB
+	DefaultTargetConf int    `form:"DefaultTargetConf"`
+
 	DemoMode         bool   `form:"DemoMode"`
 	DemoAmount       int    `form:"DemoAmount"`
 	DemoTapdHost     string `form:"DemoTapdHost"`
@@ -64,19 +111,84 @@ func LoadConfig(ctx context.Context) (context.Context, error) {
 	}
 
 	configs := &Config{
-		LNDHost:          os.Getenv("LNDHost"),
-		TapdHost:         os.Getenv("TapdHost"),
-		LNDMacaroon:      os.Getenv("LNDMacaroon"),
-		TapdMacaroon:     os.Getenv("TapdMacaroon"),
-		JWTSecret:        os.Getenv("JWTSecret"),
-		TaprootSigsDir:   os.Getenv("TaprootSigsDir"),
-		DemoMode:         demoMode,
-		DemoAmount:       demoAmount,
-		DemoTapdHost:     os.Getenv("DemoTapdHost"),
-		DemoTapdMacaroon: os.Getenv("DemoTapdMacaroon"),
+		LNDHost:                    os.Getenv("LNDHost"),
+		TapdHost:                   os.Getenv("TapdHost"),
+		LNDMacaroon:                os.Getenv("LNDMacaroon"),
+		TapdMacaroon:               os.Getenv("TapdMacaroon"),
+		JWTSecret:                  os.Getenv("JWTSecret"),
+		JWTKeysDir:                 os.Getenv("JWTKeysDir"),
+		JWTSigningKeyID:            os.Getenv("JWTSigningKeyID"),
+		AccessTokenTTL:             getEnvDuration("AccessTokenTTL", 15*time.Minute),
+		RefreshTokenTTL:            getEnvDuration("RefreshTokenTTL", 30*24*time.Hour),
+		ChallengeTTL:               getEnvDuration("ChallengeTTL", 5*time.Minute),
+		ChallengeMaxPending:        getEnvInt("ChallengeMaxPending", 10000),
+		NIP98Window:                getEnvDuration("NIP98Window", time.Minute),
+		AdminToken:                 os.Getenv("AdminToken"),
+		APIKeysFile:                os.Getenv("APIKeysFile"),
+		TaprootSigsDir:             os.Getenv("TaprootSigsDir"),
+		SendSessionTTL:             getEnvDuration("SendSessionTTL", 10*time.Minute),
+		SendSessionRetention:       getEnvDuration("SendSessionRetention", 24*time.Hour),
+		CoinSelectionStrategy:      os.Getenv("CoinSelectionStrategy"),
+		IdempotencyKeyTTL:          getEnvDuration("IdempotencyKeyTTL", 24*time.Hour),
+		OperatorFeeScheduleFile:    os.Getenv("OperatorFeeScheduleFile"),
+		OperatorFeeLedgerFile:      os.Getenv("OperatorFeeLedgerFile"),
+		PolicyFile:                 os.Getenv("PolicyFile"),
+		ContactsFile:               os.Getenv("ContactsFile"),
+		ScriptKeysFile:             os.Getenv("ScriptKeysFile"),
+		ProofDeliveryCheckInterval: getEnvDuration("ProofDeliveryCheckInterval", 5*time.Minute),
+		ProofDeliveryStuckAfter:    getEnvDuration("ProofDeliveryStuckAfter", 30*time.Minute),
+		ProofCourierAddr:           os.Getenv("ProofCourierAddr"),
+		ProofRedeliveryAuto:        os.Getenv("ProofRedeliveryAuto") == "true",
+		ProofRedeliveryMaxAttempts: getEnvInt("ProofRedeliveryMaxAttempts", 3),
+		AnchorBatchInterval:        getEnvDuration("AnchorBatchInterval", 0),
+		AnchorBatchMaxSize:         getEnvInt("AnchorBatchMaxSize", 20),
+		FeeBumpCheckInterval:       getEnvDuration("FeeBumpCheckInterval", 10*time.Minute),
+		FeeBumpStuckAfter:          getEnvDuration("FeeBumpStuckAfter", time.Hour),
+		FeeBumpAuto:                os.Getenv("FeeBumpAuto") == "true",
+		FeeBumpMaxAttempts:         getEnvInt("FeeBumpMaxAttempts", 3),
+		MuSig2Mode:                 os.Getenv("MuSig2Mode"),
+		MuSig2LocalSeed:            os.Getenv("MuSig2LocalSeed"),
+		MuSig2KeysFile:             os.Getenv("MuSig2KeysFile"),
+		MinFeeRate:                 uint64(getEnvInt("MinFeeRate", 1)),
+		MaxFeeRate:                 uint64(getEnvInt("MaxFeeRate", 500)),
+		DefaultTargetConf:          getEnvInt("DefaultTargetConf", 6),
+		DemoMode:                   demoMode,
+		DemoAmount:                 demoAmount,
+		DemoTapdHost:               os.Getenv("DemoTapdHost"),
+		DemoTapdMacaroon:           os.Getenv("DemoTapdMacaroon"),
 	}
 
 	ctx = context.WithValue(ctx, "configs", configs)
 
 	return ctx, err
 }
+
+// getEnvDuration parses a duration such as "5m" from the environment, falling
+// back to def when it is unset or malformed.
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using default %s", key, value, def)
+		return def
+	}
+	return d
+}
+
+// getEnvInt parses a non-negative integer from the environment, falling back
+// to def when it is unset or malformed.
+func getEnvInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("Invalid %s %q, using default %d", key, value, def)
+		return def
+	}
+	return n
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminMiddleware guards operator endpoints with a static bearer token.
+// Admin endpoints are disabled when no token is configured.
+func AdminMiddleware(adminToken string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if adminToken == "" {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "Admin API is disabled",
+				})
+			}
+
+			token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				return c.JSON(http.StatusUnauthorized, map[string]string{
+					"error": "Invalid admin token",
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -1,65 +1,118 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strings"
+	"tajfi-server/auth"
+	"tajfi-server/config"
+	"tajfi-server/wallet/policy"
+	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
 // Define a custom key to avoid context key collisions
 type contextKey string
 
-const pubKeyCtxKey = contextKey("public_key")
+const (
+	pubKeyCtxKey = contextKey("public_key")
+	apiKeyCtxKey = contextKey("api_key")
+)
 
-// AuthMiddleware validates the JWT and adds token data to the context
-func AuthMiddleware(secret string) echo.MiddlewareFunc {
+// AuthMiddleware authenticates the request with a bearer JWT, a NIP-98
+// "Nostr" event or an operator-issued API key and adds the caller's public
+// key to the context. Every caller is recorded in policies as seen, which
+// starts their new account cooldown whichever way they authenticate. Routes
+// reachable with an API key must be guarded with RequireScope, all others
+// with UserOnly.
+func AuthMiddleware(cfg *config.Config, tokens *auth.TokenService, apiKeys *auth.APIKeyStore, nostrEvents *auth.NIP98EventCache, policies *policy.Store) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			authHeader := c.Request().Header.Get("Authorization")
-			if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
-				return c.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "Missing or invalid Authorization header",
-				})
-			}
-
-			tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-			// Parse and validate the JWT token
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, errors.New("invalid signing method")
+			var (
+				publicKey   string
+				tokenFamily string
+				apiKey      *auth.APIKey
+				err         error
+			)
+			switch {
+			case strings.HasPrefix(authHeader, "Bearer "):
+				var claims *auth.AccessClaims
+				claims, err = tokens.Verify(strings.TrimPrefix(authHeader, "Bearer "))
+				if err == nil {
+					publicKey, tokenFamily = claims.PublicKey, claims.Family
 				}
-				return []byte(secret), nil
-			})
-
-			if err != nil || !token.Valid {
+			case strings.HasPrefix(authHeader, "Nostr "):
+				publicKey, err = verifyNostr(c, strings.TrimPrefix(authHeader, "Nostr "), cfg, nostrEvents)
+			case strings.HasPrefix(authHeader, "ApiKey "):
+				apiKey, err = apiKeys.Authenticate(strings.TrimPrefix(authHeader, "ApiKey "))
+				if err == nil {
+					publicKey = apiKey.PublicKey
+				}
+			default:
 				return c.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "Invalid token",
+					"error": "Missing or invalid Authorization header",
 				})
 			}
-
-			// Extract public key from token claims
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
+			if err != nil {
 				return c.JSON(http.StatusUnauthorized, map[string]string{
-					"error": "Invalid token claims",
+					"error": err.Error(),
 				})
 			}
 
-			publicKey, _ := claims["public_key"].(string)
-
 			log.Println("Public key:", publicKey)
 
+			if err := policies.Seen(publicKey, time.Now()); err != nil {
+				log.Printf("Failed to record account %s as seen: %v", publicKey, err)
+			}
+
 			// Add the public key to the request context
 			ctx := context.WithValue(c.Request().Context(), "public_key", publicKey)
+			// Bearer tokens also carry their token family, used by /wallet/logout
+			ctx = context.WithValue(ctx, "token_family", tokenFamily)
+			if apiKey != nil {
+				ctx = context.WithValue(ctx, apiKeyCtxKey, apiKey)
+			}
 			c.SetRequest(c.Request().WithContext(ctx))
 
 			return next(c)
 		}
 	}
 }
+
+// verifyNostr validates a NIP-98 HTTP Auth event against the current request.
+func verifyNostr(c echo.Context, encodedEvent string, cfg *config.Config, nostrEvents *auth.NIP98EventCache) (string, error) {
+	event, err := auth.ParseNIP98Event(encodedEvent)
+	if err != nil {
+		return "", errors.New("Invalid Nostr event: " + err.Error())
+	}
+
+	req := c.Request()
+	nip98Req := auth.NIP98Request{
+		Method: req.Method,
+		URL:    c.Scheme() + "://" + req.Host + req.RequestURI,
+	}
+
+	// The event has to commit to any body, so buffer it and put it back
+	// for handlers to bind the payload.
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return "", errors.New("Failed to read request body")
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		nip98Req.Body = body
+	}
+
+	publicKey, err := auth.VerifyNIP98Event(event, nip98Req, cfg.NIP98Window, nostrEvents)
+	if err != nil {
+		return "", errors.New("Invalid Nostr event: " + err.Error())
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"tajfi-server/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RequireScope lets API key requests through only if the key was granted
+// scope. Requests authenticated with a user signature are always allowed.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			apiKey, ok := c.Request().Context().Value(apiKeyCtxKey).(*auth.APIKey)
+			if ok && !apiKey.HasScope(scope) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "API key is missing scope " + scope,
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// UserOnly rejects requests authenticated with an API key.
+func UserOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if _, ok := c.Request().Context().Value(apiKeyCtxKey).(*auth.APIKey); ok {
+			return c.JSON(http.StatusForbidden, map[string]string{
+				"error": "This endpoint requires a user signature",
+			})
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,95 @@
+// Code generated by mockery v2.47.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	tapd "tajfi-server/wallet/tapd"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// CoinSelector is an autogenerated mock type for the CoinSelector type
+type CoinSelector struct {
+	mock.Mock
+}
+
+type CoinSelector_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *CoinSelector) EXPECT() *CoinSelector_Expecter {
+	return &CoinSelector_Expecter{mock: &_m.Mock}
+}
+
+// Select provides a mock function with given fields: candidates, target
+func (_m *CoinSelector) Select(candidates []tapd.PrevId, target uint64) ([]tapd.PrevId, error) {
+	ret := _m.Called(candidates, target)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Select")
+	}
+
+	var r0 []tapd.PrevId
+	var r1 error
+	if rf, ok := ret.Get(0).(func([]tapd.PrevId, uint64) ([]tapd.PrevId, error)); ok {
+		return rf(candidates, target)
+	}
+	if rf, ok := ret.Get(0).(func([]tapd.PrevId, uint64) []tapd.PrevId); ok {
+		r0 = rf(candidates, target)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]tapd.PrevId)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func([]tapd.PrevId, uint64) error); ok {
+		r1 = rf(candidates, target)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CoinSelector_Select_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Select'
+type CoinSelector_Select_Call struct {
+	*mock.Call
+}
+
+// Select is a helper method to define mock.On call
+//   - candidates []tapd.PrevId
+//   - target uint64
+func (_e *CoinSelector_Expecter) Select(candidates interface{}, target interface{}) *CoinSelector_Select_Call {
+	return &CoinSelector_Select_Call{Call: _e.mock.On("Select", candidates, target)}
+}
+
+func (_c *CoinSelector_Select_Call) Run(run func(candidates []tapd.PrevId, target uint64)) *CoinSelector_Select_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].([]tapd.PrevId), args[1].(uint64))
+	})
+	return _c
+}
+
+func (_c *CoinSelector_Select_Call) Return(_a0 []tapd.PrevId, _a1 error) *CoinSelector_Select_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *CoinSelector_Select_Call) RunAndReturn(run func([]tapd.PrevId, uint64) ([]tapd.PrevId, error)) *CoinSelector_Select_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewCoinSelector creates a new instance of CoinSelector. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewCoinSelector(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *CoinSelector {
+	mock := &CoinSelector{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
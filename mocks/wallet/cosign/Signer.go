@@ -0,0 +1,365 @@
+// Code generated by mockery v2.47.0. DO NOT EDIT.
+
+package mocks
+
+import (
+	lnd "tajfi-server/wallet/lnd"
+
+	mock "github.com/stretchr/testify/mock"
+)
+
+// Signer is an autogenerated mock type for the Signer type
+type Signer struct {
+	mock.Mock
+}
+
+type Signer_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *Signer) EXPECT() *Signer_Expecter {
+	return &Signer_Expecter{mock: &_m.Mock}
+}
+
+// Cleanup provides a mock function with given fields: sessionID
+func (_m *Signer) Cleanup(sessionID string) error {
+	ret := _m.Called(sessionID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Cleanup")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string) error); ok {
+		r0 = rf(sessionID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Signer_Cleanup_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Cleanup'
+type Signer_Cleanup_Call struct {
+	*mock.Call
+}
+
+// Cleanup is a helper method to define mock.On call
+//   - sessionID string
+func (_e *Signer_Expecter) Cleanup(sessionID interface{}) *Signer_Cleanup_Call {
+	return &Signer_Cleanup_Call{Call: _e.mock.On("Cleanup", sessionID)}
+}
+
+func (_c *Signer_Cleanup_Call) Run(run func(sessionID string)) *Signer_Cleanup_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Signer_Cleanup_Call) Return(_a0 error) *Signer_Cleanup_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Signer_Cleanup_Call) RunAndReturn(run func(string) error) *Signer_Cleanup_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CombineSig provides a mock function with given fields: sessionID, partialSig
+func (_m *Signer) CombineSig(sessionID string, partialSig string) (string, error) {
+	ret := _m.Called(sessionID, partialSig)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CombineSig")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) (string, error)); ok {
+		return rf(sessionID, partialSig)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) string); ok {
+		r0 = rf(sessionID, partialSig)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(sessionID, partialSig)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Signer_CombineSig_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CombineSig'
+type Signer_CombineSig_Call struct {
+	*mock.Call
+}
+
+// CombineSig is a helper method to define mock.On call
+//   - sessionID string
+//   - partialSig string
+func (_e *Signer_Expecter) CombineSig(sessionID interface{}, partialSig interface{}) *Signer_CombineSig_Call {
+	return &Signer_CombineSig_Call{Call: _e.mock.On("CombineSig", sessionID, partialSig)}
+}
+
+func (_c *Signer_CombineSig_Call) Run(run func(sessionID string, partialSig string)) *Signer_CombineSig_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Signer_CombineSig_Call) Return(_a0 string, _a1 error) *Signer_CombineSig_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Signer_CombineSig_Call) RunAndReturn(run func(string, string) (string, error)) *Signer_CombineSig_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// CreateSession provides a mock function with given fields: key, signers, merkleRoot
+func (_m *Signer) CreateSession(key *lnd.InternalKeyResponse, signers []string, merkleRoot []byte) (string, string, error) {
+	ret := _m.Called(key, signers, merkleRoot)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateSession")
+	}
+
+	var r0 string
+	var r1 string
+	var r2 error
+	if rf, ok := ret.Get(0).(func(*lnd.InternalKeyResponse, []string, []byte) (string, string, error)); ok {
+		return rf(key, signers, merkleRoot)
+	}
+	if rf, ok := ret.Get(0).(func(*lnd.InternalKeyResponse, []string, []byte) string); ok {
+		r0 = rf(key, signers, merkleRoot)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(*lnd.InternalKeyResponse, []string, []byte) string); ok {
+		r1 = rf(key, signers, merkleRoot)
+	} else {
+		r1 = ret.Get(1).(string)
+	}
+
+	if rf, ok := ret.Get(2).(func(*lnd.InternalKeyResponse, []string, []byte) error); ok {
+		r2 = rf(key, signers, merkleRoot)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// Signer_CreateSession_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CreateSession'
+type Signer_CreateSession_Call struct {
+	*mock.Call
+}
+
+// CreateSession is a helper method to define mock.On call
+//   - key *lnd.InternalKeyResponse
+//   - signers []string
+//   - merkleRoot []byte
+func (_e *Signer_Expecter) CreateSession(key interface{}, signers interface{}, merkleRoot interface{}) *Signer_CreateSession_Call {
+	return &Signer_CreateSession_Call{Call: _e.mock.On("CreateSession", key, signers, merkleRoot)}
+}
+
+func (_c *Signer_CreateSession_Call) Run(run func(key *lnd.InternalKeyResponse, signers []string, merkleRoot []byte)) *Signer_CreateSession_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(*lnd.InternalKeyResponse), args[1].([]string), args[2].([]byte))
+	})
+	return _c
+}
+
+func (_c *Signer_CreateSession_Call) Return(sessionID string, nonce string, err error) *Signer_CreateSession_Call {
+	_c.Call.Return(sessionID, nonce, err)
+	return _c
+}
+
+func (_c *Signer_CreateSession_Call) RunAndReturn(run func(*lnd.InternalKeyResponse, []string, []byte) (string, string, error)) *Signer_CreateSession_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewKey provides a mock function with given fields:
+func (_m *Signer) NewKey() (*lnd.InternalKeyResponse, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for NewKey")
+	}
+
+	var r0 *lnd.InternalKeyResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func() (*lnd.InternalKeyResponse, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() *lnd.InternalKeyResponse); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*lnd.InternalKeyResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Signer_NewKey_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'NewKey'
+type Signer_NewKey_Call struct {
+	*mock.Call
+}
+
+// NewKey is a helper method to define mock.On call
+func (_e *Signer_Expecter) NewKey() *Signer_NewKey_Call {
+	return &Signer_NewKey_Call{Call: _e.mock.On("NewKey")}
+}
+
+func (_c *Signer_NewKey_Call) Run(run func()) *Signer_NewKey_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run()
+	})
+	return _c
+}
+
+func (_c *Signer_NewKey_Call) Return(_a0 *lnd.InternalKeyResponse, _a1 error) *Signer_NewKey_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Signer_NewKey_Call) RunAndReturn(run func() (*lnd.InternalKeyResponse, error)) *Signer_NewKey_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RegisterNonce provides a mock function with given fields: sessionID, nonce
+func (_m *Signer) RegisterNonce(sessionID string, nonce string) error {
+	ret := _m.Called(sessionID, nonce)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RegisterNonce")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(sessionID, nonce)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Signer_RegisterNonce_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RegisterNonce'
+type Signer_RegisterNonce_Call struct {
+	*mock.Call
+}
+
+// RegisterNonce is a helper method to define mock.On call
+//   - sessionID string
+//   - nonce string
+func (_e *Signer_Expecter) RegisterNonce(sessionID interface{}, nonce interface{}) *Signer_RegisterNonce_Call {
+	return &Signer_RegisterNonce_Call{Call: _e.mock.On("RegisterNonce", sessionID, nonce)}
+}
+
+func (_c *Signer_RegisterNonce_Call) Run(run func(sessionID string, nonce string)) *Signer_RegisterNonce_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string))
+	})
+	return _c
+}
+
+func (_c *Signer_RegisterNonce_Call) Return(_a0 error) *Signer_RegisterNonce_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *Signer_RegisterNonce_Call) RunAndReturn(run func(string, string) error) *Signer_RegisterNonce_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Sign provides a mock function with given fields: sessionID, msg
+func (_m *Signer) Sign(sessionID string, msg [32]byte) (string, error) {
+	ret := _m.Called(sessionID, msg)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Sign")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, [32]byte) (string, error)); ok {
+		return rf(sessionID, msg)
+	}
+	if rf, ok := ret.Get(0).(func(string, [32]byte) string); ok {
+		r0 = rf(sessionID, msg)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(string, [32]byte) error); ok {
+		r1 = rf(sessionID, msg)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Signer_Sign_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Sign'
+type Signer_Sign_Call struct {
+	*mock.Call
+}
+
+// Sign is a helper method to define mock.On call
+//   - sessionID string
+//   - msg [32]byte
+func (_e *Signer_Expecter) Sign(sessionID interface{}, msg interface{}) *Signer_Sign_Call {
+	return &Signer_Sign_Call{Call: _e.mock.On("Sign", sessionID, msg)}
+}
+
+func (_c *Signer_Sign_Call) Run(run func(sessionID string, msg [32]byte)) *Signer_Sign_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].([32]byte))
+	})
+	return _c
+}
+
+func (_c *Signer_Sign_Call) Return(_a0 string, _a1 error) *Signer_Sign_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *Signer_Sign_Call) RunAndReturn(run func(string, [32]byte) (string, error)) *Signer_Sign_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// NewSigner creates a new instance of Signer. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewSigner(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *Signer {
+	mock := &Signer{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
@@ -139,6 +139,64 @@ func (_c *TapdClientInterface_CallNewAddress_Call) RunAndReturn(run func(string,
 	return _c
 }
 
+// CommitVirtualPSBTs provides a mock function with given fields: params
+func (_m *TapdClientInterface) CommitVirtualPSBTs(params tapd.CommitVirtualPSBTsParams) (*tapd.CommitVirtualPSBTsResponse, error) {
+	ret := _m.Called(params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CommitVirtualPSBTs")
+	}
+
+	var r0 *tapd.CommitVirtualPSBTsResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(tapd.CommitVirtualPSBTsParams) (*tapd.CommitVirtualPSBTsResponse, error)); ok {
+		return rf(params)
+	}
+	if rf, ok := ret.Get(0).(func(tapd.CommitVirtualPSBTsParams) *tapd.CommitVirtualPSBTsResponse); ok {
+		r0 = rf(params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*tapd.CommitVirtualPSBTsResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(tapd.CommitVirtualPSBTsParams) error); ok {
+		r1 = rf(params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TapdClientInterface_CommitVirtualPSBTs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'CommitVirtualPSBTs'
+type TapdClientInterface_CommitVirtualPSBTs_Call struct {
+	*mock.Call
+}
+
+// CommitVirtualPSBTs is a helper method to define mock.On call
+//   - params tapd.CommitVirtualPSBTsParams
+func (_e *TapdClientInterface_Expecter) CommitVirtualPSBTs(params interface{}) *TapdClientInterface_CommitVirtualPSBTs_Call {
+	return &TapdClientInterface_CommitVirtualPSBTs_Call{Call: _e.mock.On("CommitVirtualPSBTs", params)}
+}
+
+func (_c *TapdClientInterface_CommitVirtualPSBTs_Call) Run(run func(params tapd.CommitVirtualPSBTsParams)) *TapdClientInterface_CommitVirtualPSBTs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(tapd.CommitVirtualPSBTsParams))
+	})
+	return _c
+}
+
+func (_c *TapdClientInterface_CommitVirtualPSBTs_Call) Return(_a0 *tapd.CommitVirtualPSBTsResponse, _a1 error) *TapdClientInterface_CommitVirtualPSBTs_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *TapdClientInterface_CommitVirtualPSBTs_Call) RunAndReturn(run func(tapd.CommitVirtualPSBTsParams) (*tapd.CommitVirtualPSBTsResponse, error)) *TapdClientInterface_CommitVirtualPSBTs_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // DecodeAddr provides a mock function with given fields: tapdHost, macaroon, address
 func (_m *TapdClientInterface) DecodeAddr(tapdHost string, macaroon string, address string) (*tapd.DecodeAddrResponse, error) {
 	ret := _m.Called(tapdHost, macaroon, address)
@@ -199,9 +257,9 @@ func (_c *TapdClientInterface_DecodeAddr_Call) RunAndReturn(run func(string, str
 	return _c
 }
 
-// FundVirtualPSBT provides a mock function with given fields: tapdHost, macaroon, invoice, inputs
-func (_m *TapdClientInterface) FundVirtualPSBT(tapdHost string, macaroon string, invoice string, inputs tapd.PrevIds) (*tapd.FundVirtualPSBTResponse, error) {
-	ret := _m.Called(tapdHost, macaroon, invoice, inputs)
+// FundVirtualPSBT provides a mock function with given fields: tapdHost, macaroon, invoices, inputs, firstOutput
+func (_m *TapdClientInterface) FundVirtualPSBT(tapdHost string, macaroon string, invoices []string, inputs tapd.PrevIds, firstOutput int) (*tapd.FundVirtualPSBTResponse, error) {
+	ret := _m.Called(tapdHost, macaroon, invoices, inputs, firstOutput)
 
 	if len(ret) == 0 {
 		panic("no return value specified for FundVirtualPSBT")
@@ -209,19 +267,19 @@ func (_m *TapdClientInterface) FundVirtualPSBT(tapdHost string, macaroon string,
 
 	var r0 *tapd.FundVirtualPSBTResponse
 	var r1 error
-	if rf, ok := ret.Get(0).(func(string, string, string, tapd.PrevIds) (*tapd.FundVirtualPSBTResponse, error)); ok {
-		return rf(tapdHost, macaroon, invoice, inputs)
+	if rf, ok := ret.Get(0).(func(string, string, []string, tapd.PrevIds, int) (*tapd.FundVirtualPSBTResponse, error)); ok {
+		return rf(tapdHost, macaroon, invoices, inputs, firstOutput)
 	}
-	if rf, ok := ret.Get(0).(func(string, string, string, tapd.PrevIds) *tapd.FundVirtualPSBTResponse); ok {
-		r0 = rf(tapdHost, macaroon, invoice, inputs)
+	if rf, ok := ret.Get(0).(func(string, string, []string, tapd.PrevIds, int) *tapd.FundVirtualPSBTResponse); ok {
+		r0 = rf(tapdHost, macaroon, invoices, inputs, firstOutput)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*tapd.FundVirtualPSBTResponse)
 		}
 	}
 
-	if rf, ok := ret.Get(1).(func(string, string, string, tapd.PrevIds) error); ok {
-		r1 = rf(tapdHost, macaroon, invoice, inputs)
+	if rf, ok := ret.Get(1).(func(string, string, []string, tapd.PrevIds, int) error); ok {
+		r1 = rf(tapdHost, macaroon, invoices, inputs, firstOutput)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -237,15 +295,16 @@ type TapdClientInterface_FundVirtualPSBT_Call struct {
 // FundVirtualPSBT is a helper method to define mock.On call
 //   - tapdHost string
 //   - macaroon string
-//   - invoice string
+//   - invoices []string
 //   - inputs tapd.PrevIds
-func (_e *TapdClientInterface_Expecter) FundVirtualPSBT(tapdHost interface{}, macaroon interface{}, invoice interface{}, inputs interface{}) *TapdClientInterface_FundVirtualPSBT_Call {
-	return &TapdClientInterface_FundVirtualPSBT_Call{Call: _e.mock.On("FundVirtualPSBT", tapdHost, macaroon, invoice, inputs)}
+//   - firstOutput int
+func (_e *TapdClientInterface_Expecter) FundVirtualPSBT(tapdHost interface{}, macaroon interface{}, invoices interface{}, inputs interface{}, firstOutput interface{}) *TapdClientInterface_FundVirtualPSBT_Call {
+	return &TapdClientInterface_FundVirtualPSBT_Call{Call: _e.mock.On("FundVirtualPSBT", tapdHost, macaroon, invoices, inputs, firstOutput)}
 }
 
-func (_c *TapdClientInterface_FundVirtualPSBT_Call) Run(run func(tapdHost string, macaroon string, invoice string, inputs tapd.PrevIds)) *TapdClientInterface_FundVirtualPSBT_Call {
+func (_c *TapdClientInterface_FundVirtualPSBT_Call) Run(run func(tapdHost string, macaroon string, invoices []string, inputs tapd.PrevIds, firstOutput int)) *TapdClientInterface_FundVirtualPSBT_Call {
 	_c.Call.Run(func(args mock.Arguments) {
-		run(args[0].(string), args[1].(string), args[2].(string), args[3].(tapd.PrevIds))
+		run(args[0].(string), args[1].(string), args[2].([]string), args[3].(tapd.PrevIds), args[4].(int))
 	})
 	return _c
 }
@@ -255,7 +314,7 @@ func (_c *TapdClientInterface_FundVirtualPSBT_Call) Return(fundedPsbt *tapd.Fund
 	return _c
 }
 
-func (_c *TapdClientInterface_FundVirtualPSBT_Call) RunAndReturn(run func(string, string, string, tapd.PrevIds) (*tapd.FundVirtualPSBTResponse, error)) *TapdClientInterface_FundVirtualPSBT_Call {
+func (_c *TapdClientInterface_FundVirtualPSBT_Call) RunAndReturn(run func(string, string, []string, tapd.PrevIds, int) (*tapd.FundVirtualPSBTResponse, error)) *TapdClientInterface_FundVirtualPSBT_Call {
 	_c.Call.Return(run)
 	return _c
 }
@@ -435,6 +494,160 @@ func (_c *TapdClientInterface_GetUtxos_Call) RunAndReturn(run func(string, strin
 	return _c
 }
 
+// PublishAndLogTransfer provides a mock function with given fields: params
+func (_m *TapdClientInterface) PublishAndLogTransfer(params tapd.PublishAndLogTransferParams) (*tapd.AssetTransferResponse, error) {
+	ret := _m.Called(params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PublishAndLogTransfer")
+	}
+
+	var r0 *tapd.AssetTransferResponse
+	var r1 error
+	if rf, ok := ret.Get(0).(func(tapd.PublishAndLogTransferParams) (*tapd.AssetTransferResponse, error)); ok {
+		return rf(params)
+	}
+	if rf, ok := ret.Get(0).(func(tapd.PublishAndLogTransferParams) *tapd.AssetTransferResponse); ok {
+		r0 = rf(params)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*tapd.AssetTransferResponse)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(tapd.PublishAndLogTransferParams) error); ok {
+		r1 = rf(params)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// TapdClientInterface_PublishAndLogTransfer_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PublishAndLogTransfer'
+type TapdClientInterface_PublishAndLogTransfer_Call struct {
+	*mock.Call
+}
+
+// PublishAndLogTransfer is a helper method to define mock.On call
+//   - params tapd.PublishAndLogTransferParams
+func (_e *TapdClientInterface_Expecter) PublishAndLogTransfer(params interface{}) *TapdClientInterface_PublishAndLogTransfer_Call {
+	return &TapdClientInterface_PublishAndLogTransfer_Call{Call: _e.mock.On("PublishAndLogTransfer", params)}
+}
+
+func (_c *TapdClientInterface_PublishAndLogTransfer_Call) Run(run func(params tapd.PublishAndLogTransferParams)) *TapdClientInterface_PublishAndLogTransfer_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(tapd.PublishAndLogTransferParams))
+	})
+	return _c
+}
+
+func (_c *TapdClientInterface_PublishAndLogTransfer_Call) Return(_a0 *tapd.AssetTransferResponse, _a1 error) *TapdClientInterface_PublishAndLogTransfer_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
+func (_c *TapdClientInterface_PublishAndLogTransfer_Call) RunAndReturn(run func(tapd.PublishAndLogTransferParams) (*tapd.AssetTransferResponse, error)) *TapdClientInterface_PublishAndLogTransfer_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// PushProof provides a mock function with given fields: tapdHost, macaroon, params
+func (_m *TapdClientInterface) PushProof(tapdHost string, macaroon string, params tapd.PushProofParams) error {
+	ret := _m.Called(tapdHost, macaroon, params)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PushProof")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, tapd.PushProofParams) error); ok {
+		r0 = rf(tapdHost, macaroon, params)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TapdClientInterface_PushProof_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PushProof'
+type TapdClientInterface_PushProof_Call struct {
+	*mock.Call
+}
+
+// PushProof is a helper method to define mock.On call
+//   - tapdHost string
+//   - macaroon string
+//   - params tapd.PushProofParams
+func (_e *TapdClientInterface_Expecter) PushProof(tapdHost interface{}, macaroon interface{}, params interface{}) *TapdClientInterface_PushProof_Call {
+	return &TapdClientInterface_PushProof_Call{Call: _e.mock.On("PushProof", tapdHost, macaroon, params)}
+}
+
+func (_c *TapdClientInterface_PushProof_Call) Run(run func(tapdHost string, macaroon string, params tapd.PushProofParams)) *TapdClientInterface_PushProof_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string), args[2].(tapd.PushProofParams))
+	})
+	return _c
+}
+
+func (_c *TapdClientInterface_PushProof_Call) Return(_a0 error) *TapdClientInterface_PushProof_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *TapdClientInterface_PushProof_Call) RunAndReturn(run func(string, string, tapd.PushProofParams) error) *TapdClientInterface_PushProof_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// RemoveUTXOLease provides a mock function with given fields: tapdHost, macaroon, outpoint
+func (_m *TapdClientInterface) RemoveUTXOLease(tapdHost string, macaroon string, outpoint tapd.Outpoint) error {
+	ret := _m.Called(tapdHost, macaroon, outpoint)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RemoveUTXOLease")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, tapd.Outpoint) error); ok {
+		r0 = rf(tapdHost, macaroon, outpoint)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TapdClientInterface_RemoveUTXOLease_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'RemoveUTXOLease'
+type TapdClientInterface_RemoveUTXOLease_Call struct {
+	*mock.Call
+}
+
+// RemoveUTXOLease is a helper method to define mock.On call
+//   - tapdHost string
+//   - macaroon string
+//   - outpoint tapd.Outpoint
+func (_e *TapdClientInterface_Expecter) RemoveUTXOLease(tapdHost interface{}, macaroon interface{}, outpoint interface{}) *TapdClientInterface_RemoveUTXOLease_Call {
+	return &TapdClientInterface_RemoveUTXOLease_Call{Call: _e.mock.On("RemoveUTXOLease", tapdHost, macaroon, outpoint)}
+}
+
+func (_c *TapdClientInterface_RemoveUTXOLease_Call) Run(run func(tapdHost string, macaroon string, outpoint tapd.Outpoint)) *TapdClientInterface_RemoveUTXOLease_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string), args[1].(string), args[2].(tapd.Outpoint))
+	})
+	return _c
+}
+
+func (_c *TapdClientInterface_RemoveUTXOLease_Call) Return(_a0 error) *TapdClientInterface_RemoveUTXOLease_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *TapdClientInterface_RemoveUTXOLease_Call) RunAndReturn(run func(string, string, tapd.Outpoint) error) *TapdClientInterface_RemoveUTXOLease_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // SendAssets provides a mock function with given fields: tapdHost, macaroon, invoice
 func (_m *TapdClientInterface) SendAssets(tapdHost string, macaroon string, invoice string) (*tapd.FundVirtualPSBTResponse, error) {
 	ret := _m.Called(tapdHost, macaroon, invoice)
@@ -0,0 +1,465 @@
+package batch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"tajfi-server/wallet/lnd"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+	"time"
+)
+
+// Batch states. An open batch takes new sends; a sealed one takes no more
+// and is anchored once every send in it is signed or gone. A batch tapd
+// rejects as a whole is split, with each of its vPSBTs anchored on its own.
+const (
+	StatusOpen     = "open"
+	StatusSealed   = "sealed"
+	StatusAnchored = "anchored"
+	StatusSplit    = "split"
+)
+
+// retainedBatches is how many closed batches are kept for the admin API.
+const retainedBatches = 100
+
+var ErrNotInBatch = errors.New("send session has no anchor outputs reserved in a pending batch")
+
+// Batch is a set of signed vPSBTs of different sends anchored in one
+// on-chain transaction. Every send is funded with anchor outputs of its own
+// in that transaction, reserved when it starts.
+type Batch struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	SessionIDs []string   `json:"session_ids"`
+	Outputs    int        `json:"anchor_outputs"`     // reserved so far
+	FeeRate    uint64     `json:"fee_rate,omitempty"` // highest rate asked for by its sessions
+	AnchorTx   string     `json:"anchor_tx_hash,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ClosedAt   *time.Time `json:"closed_at,omitempty"`
+
+	slots []*slot
+}
+
+// Slot is the range of anchor outputs of a batch reserved for one send. Its
+// vPSBT has to be funded with its recipients starting at FirstOutput.
+type Slot struct {
+	BatchID     string
+	FirstOutput int
+}
+
+type slot struct {
+	first     int
+	outputs   int
+	sessionID string
+	released  bool   // the send was never funded
+	psbt      string // signed vPSBT, once queued
+}
+
+// Options configures a Batcher.
+type Options struct {
+	TapdHost     string
+	TapdMacaroon string
+	LNDHost      string
+	LNDMacaroon  string
+	// TargetConf prices batches none of whose sends asked for a fee rate
+	TargetConf int
+	// Interval is how often the open batch is sealed and ready batches are
+	// anchored
+	Interval time.Duration
+	// MaxSize seals the open batch as soon as it holds this many sends
+	MaxSize int
+}
+
+// Batcher queues the signed vPSBTs of completed sends and anchors them
+// together, so many users' transfers share one on-chain transaction.
+type Batcher struct {
+	mu           sync.Mutex
+	anchorMu     sync.Mutex
+	tapdClient   tapd.TapdClientInterface
+	sendSessions *sessions.Store
+	opts         Options
+	open         *Batch
+	sealed       []*Batch
+	closed       []*Batch
+	onAnchored   func(*sessions.Session)
+}
+
+func NewBatcher(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, opts Options) *Batcher {
+	return &Batcher{
+		tapdClient:   tapdClient,
+		sendSessions: sendSessions,
+		opts:         opts,
+	}
+}
+
+// OnAnchored sets a hook called with every session once it is anchored.
+func (b *Batcher) OnAnchored(hook func(*sessions.Session)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.onAnchored = hook
+}
+
+// Reserve sets aside outputs anchor outputs of the open batch for a send
+// about to be funded. The caller must either Assign the slot to the send's
+// session or Release it.
+func (b *Batcher) Reserve(outputs int) (Slot, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.open == nil {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return Slot{}, fmt.Errorf("failed to generate batch id: %w", err)
+		}
+		b.open = &Batch{
+			ID:        hex.EncodeToString(id),
+			Status:    StatusOpen,
+			CreatedAt: time.Now().UTC(),
+		}
+	}
+	batch := b.open
+
+	batch.slots = append(batch.slots, &slot{first: batch.Outputs, outputs: outputs})
+	reserved := Slot{BatchID: batch.ID, FirstOutput: batch.Outputs}
+	batch.Outputs += outputs
+
+	if b.opts.MaxSize > 0 && len(batch.slots) >= b.opts.MaxSize {
+		b.sealLocked()
+	}
+	return reserved, nil
+}
+
+// Assign ties a reserved slot to the session of the send funded with it.
+func (b *Batcher) Assign(reserved Slot, sessionID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if batch, s := b.slotLocked(reserved); s != nil {
+		s.sessionID = sessionID
+		batch.SessionIDs = append(batch.SessionIDs, sessionID)
+	}
+}
+
+// Release gives up a slot whose send could not be funded. Its outputs pay
+// LND's wallet once the batch is anchored.
+func (b *Batcher) Release(reserved Slot) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, s := b.slotLocked(reserved); s != nil {
+		s.released = true
+	}
+}
+
+// Enqueue adds the signed vPSBT of a session to the batch its anchor outputs
+// are reserved in and moves the session to queued. A sealed batch is
+// anchored straight away once its last send is queued.
+func (b *Batcher) Enqueue(session *sessions.Session, signedPSBT string) (*sessions.Session, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var (
+		batch  *Batch
+		queued *slot
+	)
+	for _, pending := range b.pendingLocked() {
+		if pending.ID != session.BatchID {
+			continue
+		}
+		for _, s := range pending.slots {
+			if s.sessionID == session.ID {
+				batch, queued = pending, s
+			}
+		}
+	}
+	if queued == nil {
+		return nil, ErrNotInBatch
+	}
+
+	updated, err := b.sendSessions.Transition(session.ID, sessions.StatusQueued, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	queued.psbt = signedPSBT
+	if session.FeeRate > batch.FeeRate {
+		batch.FeeRate = session.FeeRate
+	}
+
+	if batch.Status == StatusSealed && b.readyLocked(batch) {
+		b.removeSealedLocked(batch)
+		go b.anchor(batch)
+	}
+	return updated, nil
+}
+
+// Run seals the open batch and anchors the ready ones every interval until
+// the process exits.
+func (b *Batcher) Run() {
+	ticker := time.NewTicker(b.opts.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		b.Flush()
+	}
+}
+
+// Flush seals the open batch, if it holds anything, and anchors every
+// sealed batch whose sends are all signed or gone.
+func (b *Batcher) Flush() {
+	b.mu.Lock()
+	if b.open != nil {
+		b.sealLocked()
+	}
+	var ready []*Batch
+	for _, batch := range append([]*Batch(nil), b.sealed...) {
+		if b.readyLocked(batch) {
+			b.removeSealedLocked(batch)
+			ready = append(ready, batch)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, batch := range ready {
+		b.anchor(batch)
+	}
+}
+
+// List returns the pending batches and the most recent closed ones, newest
+// first.
+func (b *Batcher) List() []Batch {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var list []Batch
+	for _, batch := range b.pendingLocked() {
+		list = append(list, batch.view())
+	}
+	for _, batch := range b.closed {
+		list = append(list, batch.view())
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// anchor has tapd anchor every queued vPSBT of batch in one transaction.
+// Should tapd reject the batch, each vPSBT is anchored on its own instead
+// so one bad send cannot hold up the others.
+func (b *Batcher) anchor(batch *Batch) {
+	// One batch at a time, so batches don't compete for the same BTC inputs
+	b.anchorMu.Lock()
+	defer b.anchorMu.Unlock()
+
+	b.mu.Lock()
+	var queued []*slot
+	for _, s := range batch.slots {
+		if s.psbt != "" {
+			queued = append(queued, s)
+		}
+	}
+	feeRate := batch.FeeRate
+	b.mu.Unlock()
+
+	if len(queued) == 0 {
+		log.Printf("Dropping batch %s, none of its sends were signed", batch.ID)
+		return
+	}
+
+	transfer, err := b.anchorSlots(queued, feeRate)
+
+	switch {
+	case err == nil:
+		log.Printf("Anchored batch %s of %d sends in %s", batch.ID, len(queued), transfer.AnchorTxHash)
+		for _, s := range queued {
+			b.settle(s.sessionID, transfer.AnchorTxHash, nil)
+		}
+		b.close(batch, StatusAnchored, transfer.AnchorTxHash, nil)
+	case len(queued) == 1:
+		b.settle(queued[0].sessionID, "", err)
+		b.close(batch, StatusSplit, "", err)
+	default:
+		log.Printf("Failed to anchor batch %s, anchoring its %d sends one by one: %v", batch.ID, len(queued), err)
+		for _, s := range queued {
+			single, err := b.anchorSlots([]*slot{s}, feeRate)
+			if err != nil {
+				b.settle(s.sessionID, "", err)
+				continue
+			}
+			b.settle(s.sessionID, single.AnchorTxHash, nil)
+		}
+		b.close(batch, StatusSplit, "", err)
+	}
+}
+
+// anchorSlots has tapd anchor the vPSBTs of slots in one transaction. The
+// anchor outputs they don't use, reserved by sends that never got signed or
+// by vPSBTs anchored separately, each pay a fresh address of LND's wallet so
+// no two outputs of the transaction share a script.
+func (b *Batcher) anchorSlots(slots []*slot, feeRate uint64) (*tapd.AssetTransferResponse, error) {
+	var (
+		outputs int
+		psbts   = make([]string, 0, len(slots))
+		used    = make(map[int]bool)
+	)
+	for _, s := range slots {
+		psbts = append(psbts, s.psbt)
+		for i := s.first; i < s.first+s.outputs; i++ {
+			used[i] = true
+		}
+		if end := s.first + s.outputs; end > outputs {
+			outputs = end
+		}
+	}
+
+	unused := make(map[int][]byte, outputs-len(used))
+	for i := 0; i < outputs; i++ {
+		if used[i] {
+			continue
+		}
+		script, err := lnd.NewTaprootScript(b.opts.LNDHost, b.opts.LNDMacaroon)
+		if err != nil {
+			return nil, err
+		}
+		unused[i] = script
+	}
+
+	return b.tapdClient.AnchorVirtualPSBT(tapd.AnchorVirtualPSBTParams{
+		VirtualPSBTs:   psbts,
+		AnchorTemplate: tapd.AnchorTemplate(outputs, unused),
+		FeeRate:        feeRate,
+		TargetConf:     b.opts.TargetConf,
+		TapdHost:       b.opts.TapdHost,
+		Macaroon:       b.opts.TapdMacaroon,
+		LNDHost:        b.opts.LNDHost,
+		LNDMacaroon:    b.opts.LNDMacaroon,
+	})
+}
+
+// settle moves a queued session to anchored in anchorTxHash, or to failed.
+func (b *Batcher) settle(id, anchorTxHash string, err error) {
+	if err != nil {
+		b.sendSessions.Fail(id, err)
+		return
+	}
+
+	session, err := b.sendSessions.Transition(id, sessions.StatusAnchored, func(s *sessions.Session) {
+		s.AnchorTxHash = anchorTxHash
+	})
+	if err != nil {
+		log.Printf("Failed to mark send session %s as anchored: %v", id, err)
+		return
+	}
+
+	b.mu.Lock()
+	hook := b.onAnchored
+	b.mu.Unlock()
+	if hook != nil {
+		hook(session)
+	}
+}
+
+// close records batch as done with status, anchored in anchorTxHash or
+// rejected by tapd with err.
+func (b *Batcher) close(batch *Batch, status, anchorTxHash string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	closedAt := time.Now().UTC()
+	batch.Status = status
+	batch.AnchorTx = anchorTxHash
+	if err != nil {
+		batch.Error = err.Error()
+	}
+	batch.ClosedAt = &closedAt
+	for _, s := range batch.slots {
+		s.psbt = ""
+	}
+
+	b.closed = append(b.closed, batch)
+	if len(b.closed) > retainedBatches {
+		b.closed = b.closed[len(b.closed)-retainedBatches:]
+	}
+}
+
+// readyLocked reports whether no send of batch may still be queued: each
+// is queued already, was never funded or has left the signing states.
+// Callers must hold b.mu.
+func (b *Batcher) readyLocked(batch *Batch) bool {
+	for _, s := range batch.slots {
+		if s.released || s.psbt != "" {
+			continue
+		}
+		if s.sessionID == "" {
+			// Still being funded
+			return false
+		}
+		status, ok := b.sendSessions.Status(s.sessionID)
+		if !ok {
+			continue
+		}
+		switch status {
+		case sessions.StatusFunded, sessions.StatusAwaitingSignature, sessions.StatusSigned:
+			return false
+		}
+	}
+	return true
+}
+
+// sealLocked closes the open batch to new sends. Callers must hold b.mu.
+func (b *Batcher) sealLocked() {
+	b.open.Status = StatusSealed
+	b.sealed = append(b.sealed, b.open)
+	b.open = nil
+}
+
+// removeSealedLocked takes batch off the sealed list before it is anchored.
+// Callers must hold b.mu.
+func (b *Batcher) removeSealedLocked(batch *Batch) {
+	for i, sealed := range b.sealed {
+		if sealed == batch {
+			b.sealed = append(b.sealed[:i], b.sealed[i+1:]...)
+			return
+		}
+	}
+}
+
+// pendingLocked returns the open and sealed batches. Callers must hold b.mu.
+func (b *Batcher) pendingLocked() []*Batch {
+	pending := append([]*Batch(nil), b.sealed...)
+	if b.open != nil {
+		pending = append(pending, b.open)
+	}
+	return pending
+}
+
+// slotLocked finds a reserved slot in the pending batches. Callers must hold
+// b.mu.
+func (b *Batcher) slotLocked(reserved Slot) (*Batch, *slot) {
+	for _, batch := range b.pendingLocked() {
+		if batch.ID != reserved.BatchID {
+			continue
+		}
+		for _, s := range batch.slots {
+			if s.first == reserved.FirstOutput {
+				return batch, s
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (batch *Batch) view() Batch {
+	v := *batch
+	v.SessionIDs = append([]string(nil), batch.SessionIDs...)
+	v.slots = nil
+	return v
+}
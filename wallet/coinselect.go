@@ -0,0 +1,161 @@
+package wallet
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"tajfi-server/wallet/tapd"
+)
+
+// Coin selection strategies that can be chosen per request or by config.
+const (
+	CoinSelectionBranchAndBound = "bnb"
+	CoinSelectionFewestInputs   = "fewest_inputs"
+	CoinSelectionOldestFirst    = "oldest_first"
+	CoinSelectionPrivacy        = "privacy"
+)
+
+// bnbMaxTries bounds the branch-and-bound search.
+const bnbMaxTries = 100000
+
+// CoinSelector picks which of the caller's vUTXOs fund a send of target.
+type CoinSelector interface {
+	Select(candidates []tapd.PrevId, target uint64) ([]tapd.PrevId, error)
+}
+
+// NewCoinSelector returns the selector registered under strategy.
+func NewCoinSelector(strategy string) (CoinSelector, error) {
+	switch strategy {
+	case CoinSelectionBranchAndBound, "":
+		return branchAndBound{}, nil
+	case CoinSelectionFewestInputs:
+		return fewestInputs{}, nil
+	case CoinSelectionOldestFirst:
+		return oldestFirst{}, nil
+	case CoinSelectionPrivacy:
+		return privacyPreserving{}, nil
+	default:
+		return nil, fmt.Errorf("unknown coin selection strategy %q", strategy)
+	}
+}
+
+// branchAndBound looks for a set of inputs matching target exactly, so no
+// change output is needed, and falls back to fewestInputs otherwise.
+type branchAndBound struct{}
+
+func (branchAndBound) Select(candidates []tapd.PrevId, target uint64) ([]tapd.PrevId, error) {
+	sorted := sortedCopy(candidates, func(a, b tapd.PrevId) bool { return a.Amount > b.Amount })
+
+	// remaining[i] is the sum of sorted[i:], used to prune branches that
+	// can no longer reach target
+	remaining := make([]uint64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + uint64(sorted[i].Amount)
+	}
+
+	var (
+		tries    int
+		selected []int
+		search   func(i int, sum uint64) bool
+	)
+	search = func(i int, sum uint64) bool {
+		tries++
+		if sum == target {
+			return true
+		}
+		if i == len(sorted) || sum > target || sum+remaining[i] < target || tries > bnbMaxTries {
+			return false
+		}
+
+		selected = append(selected, i)
+		if search(i+1, sum+uint64(sorted[i].Amount)) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+		return search(i+1, sum)
+	}
+
+	if target > 0 && search(0, 0) {
+		inputs := make([]tapd.PrevId, len(selected))
+		for j, i := range selected {
+			inputs[j] = sorted[i]
+		}
+		return inputs, nil
+	}
+
+	return fewestInputs{}.Select(candidates, target)
+}
+
+// fewestInputs spends the largest vUTXOs first.
+type fewestInputs struct{}
+
+func (fewestInputs) Select(candidates []tapd.PrevId, target uint64) ([]tapd.PrevId, error) {
+	sorted := sortedCopy(candidates, func(a, b tapd.PrevId) bool { return a.Amount > b.Amount })
+	return accumulate(sorted, target)
+}
+
+// oldestFirst spends the vUTXOs with the lowest anchor height first, leaving
+// unconfirmed ones for last.
+type oldestFirst struct{}
+
+func (oldestFirst) Select(candidates []tapd.PrevId, target uint64) ([]tapd.PrevId, error) {
+	sorted := sortedCopy(candidates, func(a, b tapd.PrevId) bool {
+		if (a.BlockHeight == 0) != (b.BlockHeight == 0) {
+			return b.BlockHeight == 0
+		}
+		return a.BlockHeight < b.BlockHeight
+	})
+	return accumulate(sorted, target)
+}
+
+// privacyPreserving reveals as little of the balance as possible: a single
+// vUTXO just large enough if there is one, otherwise random vUTXOs so the
+// inputs of a transfer say little about the rest of the wallet.
+type privacyPreserving struct{}
+
+func (privacyPreserving) Select(candidates []tapd.PrevId, target uint64) ([]tapd.PrevId, error) {
+	var best *tapd.PrevId
+	for i, candidate := range candidates {
+		if uint64(candidate.Amount) >= target && (best == nil || candidate.Amount < best.Amount) {
+			best = &candidates[i]
+		}
+	}
+	if best != nil {
+		return []tapd.PrevId{*best}, nil
+	}
+
+	shuffled := sortedCopy(candidates, nil)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return accumulate(shuffled, target)
+}
+
+// accumulate takes inputs in order until target is covered.
+func accumulate(ordered []tapd.PrevId, target uint64) ([]tapd.PrevId, error) {
+	var (
+		sum    uint64
+		inputs []tapd.PrevId
+	)
+	for _, input := range ordered {
+		if sum >= target && len(inputs) > 0 {
+			break
+		}
+		inputs = append(inputs, input)
+		sum += uint64(input.Amount)
+	}
+
+	if sum < target || len(inputs) == 0 {
+		return nil, fmt.Errorf("%w: sending %d but only %d available", ErrInsufficientBalance, target, sum)
+	}
+	return inputs, nil
+}
+
+// sortedCopy returns a copy of inputs, sorted with less if given.
+func sortedCopy(inputs []tapd.PrevId, less func(a, b tapd.PrevId) bool) []tapd.PrevId {
+	sorted := append([]tapd.PrevId(nil), inputs...)
+	if less != nil {
+		sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	}
+	return sorted
+}
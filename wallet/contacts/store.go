@@ -0,0 +1,271 @@
+package contacts
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"tajfi-server/auth"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// MaxPerUser caps how many contacts one public key may save.
+const MaxPerUser = 500
+
+var (
+	ErrContactNotFound = errors.New("contact not found")
+	ErrInvalidContact  = errors.New("invalid contact")
+	ErrTooManyContacts = fmt.Errorf("at most %d contacts may be saved", MaxPerUser)
+)
+
+// Contact is a saved destination of a user. It holds either the npub of
+// another tajfi user, who gets a fresh address minted for every send, or a
+// script key and internal key that fresh addresses can be made for, since
+// tap addresses themselves must not be reused.
+type Contact struct {
+	ID          string    `json:"id"`
+	Owner       string    `json:"-"`
+	Label       string    `json:"label"`
+	Npub        string    `json:"npub,omitempty"`
+	ScriptKey   string    `json:"script_key,omitempty"`
+	InternalKey string    `json:"internal_key,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// storedContact keeps the owner in the persisted file, which the API leaves
+// out.
+type storedContact struct {
+	Contact
+	Owner string `json:"owner"`
+}
+
+// PubKey returns the x-only key the contact's npub decodes to.
+func (c *Contact) PubKey() (string, error) {
+	return auth.DecodeNpub(c.Npub)
+}
+
+// Validate checks the contact names exactly one kind of destination with
+// well formed keys.
+func (c *Contact) Validate() error {
+	if strings.TrimSpace(c.Label) == "" {
+		return fmt.Errorf("%w: label is required", ErrInvalidContact)
+	}
+
+	switch {
+	case c.Npub != "" && c.ScriptKey == "" && c.InternalKey == "":
+		if _, err := c.PubKey(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidContact, err)
+		}
+	case c.Npub == "" && c.ScriptKey != "" && c.InternalKey != "":
+		if !isPubKey(c.ScriptKey, 32) {
+			return fmt.Errorf("%w: script_key must be a 32-byte x-only public key in hex", ErrInvalidContact)
+		}
+		if !isPubKey(c.InternalKey, 33) {
+			return fmt.Errorf("%w: internal_key must be a 33-byte compressed public key in hex", ErrInvalidContact)
+		}
+	default:
+		return fmt.Errorf("%w: give either npub, or both script_key and internal_key", ErrInvalidContact)
+	}
+	return nil
+}
+
+// isPubKey reports whether keyHex is a valid secp256k1 key of size bytes,
+// x-only for 32 and compressed for 33.
+func isPubKey(keyHex string, size int) bool {
+	key, err := hex.DecodeString(keyHex)
+	if err != nil || len(key) != size {
+		return false
+	}
+	if size == 32 {
+		key = append([]byte{0x02}, key...)
+	}
+	_, err = btcec.ParsePubKey(key)
+	return err == nil
+}
+
+// Store keeps every user's contacts in memory and, when path is set,
+// persists them to a JSON file.
+type Store struct {
+	mu       sync.RWMutex
+	path     string
+	contacts map[string]*Contact
+}
+
+// LoadStore opens the contacts store at path, which may not exist yet. An
+// empty path keeps contacts in memory only.
+func LoadStore(path string) (*Store, error) {
+	s := &Store{path: path, contacts: make(map[string]*Contact)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []storedContact
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, entry := range stored {
+		contact := entry.Contact
+		contact.Owner = entry.Owner
+		s.contacts[contact.ID] = &contact
+	}
+	return s, nil
+}
+
+// List returns copies of owner's contacts, sorted by label.
+func (s *Store) List(owner string) []Contact {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Contact{}
+	for _, contact := range s.contacts {
+		if contact.Owner == owner {
+			list = append(list, *contact)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Label != list[j].Label {
+			return list[i].Label < list[j].Label
+		}
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Get returns a copy of owner's contact with the given ID. Contacts of
+// someone else are reported as not found.
+func (s *Store) Get(owner, id string) (*Contact, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	contact, ok := s.contacts[id]
+	if !ok || contact.Owner != owner {
+		return nil, ErrContactNotFound
+	}
+	c := *contact
+	return &c, nil
+}
+
+// Create validates contact and saves it for owner under a new ID.
+func (s *Store) Create(owner string, contact Contact) (*Contact, error) {
+	if err := contact.Validate(); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate contact id: %w", err)
+	}
+	now := time.Now().UTC()
+	contact.ID = hex.EncodeToString(id)
+	contact.Owner = owner
+	contact.CreatedAt = now
+	contact.UpdatedAt = now
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.countLocked(owner) >= MaxPerUser {
+		return nil, ErrTooManyContacts
+	}
+	s.contacts[contact.ID] = &contact
+	if err := s.saveLocked(); err != nil {
+		delete(s.contacts, contact.ID)
+		return nil, err
+	}
+	c := contact
+	return &c, nil
+}
+
+// Update replaces the label and destination of owner's contact id.
+func (s *Store) Update(owner, id string, contact Contact) (*Contact, error) {
+	if err := contact.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.contacts[id]
+	if !ok || previous.Owner != owner {
+		return nil, ErrContactNotFound
+	}
+	contact.ID = id
+	contact.Owner = owner
+	contact.CreatedAt = previous.CreatedAt
+	contact.UpdatedAt = time.Now().UTC()
+
+	s.contacts[id] = &contact
+	if err := s.saveLocked(); err != nil {
+		s.contacts[id] = previous
+		return nil, err
+	}
+	c := contact
+	return &c, nil
+}
+
+// Delete removes owner's contact id.
+func (s *Store) Delete(owner, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.contacts[id]
+	if !ok || previous.Owner != owner {
+		return ErrContactNotFound
+	}
+	delete(s.contacts, id)
+	if err := s.saveLocked(); err != nil {
+		s.contacts[id] = previous
+		return err
+	}
+	return nil
+}
+
+func (s *Store) countLocked(owner string) (count int) {
+	for _, contact := range s.contacts {
+		if contact.Owner == owner {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	stored := make([]storedContact, 0, len(s.contacts))
+	for _, contact := range s.contacts {
+		stored = append(stored, storedContact{Contact: *contact, Owner: contact.Owner})
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].CreatedAt.Before(stored[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write contacts: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
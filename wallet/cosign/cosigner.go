@@ -0,0 +1,337 @@
+package cosign
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"tajfi-server/wallet/lnd"
+	"tajfi-server/wallet/sessions"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+)
+
+var (
+	ErrNothingToCosign    = errors.New("anchor transaction spends no MuSig2 anchor outputs")
+	ErrForeignAnchorKey   = errors.New("anchor transaction spends another user's MuSig2 anchor output")
+	ErrOutputKeyMismatch  = errors.New("anchor input is not a key spend of its MuSig2 internal key")
+	ErrInvalidNonce       = errors.New("invalid public nonce")
+	ErrNoncesMissing      = errors.New("public nonces have not been registered for every input")
+	ErrInvalidPartialSig  = errors.New("invalid partial signature")
+	ErrFinalSigInvalid    = errors.New("combined signature does not verify")
+	ErrNoncesAlreadyExist = errors.New("public nonces were already registered")
+)
+
+// Cosigner controls anchor outputs together with their users: their
+// internal key is the MuSig2 aggregate of a server key and the user's key,
+// so neither can spend them alone. Users sign with the secret key of the
+// even-y point of their x-only public key.
+type Cosigner struct {
+	signer Signer
+	keys   *KeyStore
+}
+
+func NewCosigner(signer Signer, keys *KeyStore) *Cosigner {
+	return &Cosigner{signer: signer, keys: keys}
+}
+
+// NewInternalKey returns a fresh anchor internal key for a tap address of
+// userPubKey, the x-only public key in hex. It has no key locator, since
+// no single wallet holds its private key.
+func (c *Cosigner) NewInternalKey(userPubKey string) (*lnd.InternalKeyResponse, error) {
+	serverKey, err := c.signer.NewKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server key: %w", err)
+	}
+
+	signers := []string{serverKey.RawKeyBytes, "02" + userPubKey}
+	keys, err := parsePubKeys(signers)
+	if err != nil {
+		return nil, err
+	}
+	aggregate, _, _, err := musig2.AggregateKeys(keys, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate keys: %w", err)
+	}
+
+	internalKey := hex.EncodeToString(aggregate.FinalKey.SerializeCompressed())
+	if err := c.keys.Add(AnchorKey{
+		InternalKey: internalKey,
+		UserKey:     userPubKey,
+		ServerKey:   *serverKey,
+		CreatedAt:   time.Now().UTC(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &lnd.InternalKeyResponse{RawKeyBytes: internalKey}, nil
+}
+
+// Controls reports whether internalKey, compressed or x-only in hex, is
+// one of the MuSig2 anchor keys.
+func (c *Cosigner) Controls(internalKey string) bool {
+	_, ok := c.key(internalKey)
+	return ok
+}
+
+// Prepare starts a signing session with the server's key for every input
+// of the base64 anchorPSBT spending one of pubKey's MuSig2 anchor outputs.
+// The returned inputs carry the sighashes to sign and the server's nonces.
+func (c *Cosigner) Prepare(pubKey, anchorPSBT string) (_ []sessions.CosignInput, err error) {
+	p, err := parsePSBT(anchorPSBT)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions started for earlier inputs are dropped if a later one fails
+	var inputs []sessions.CosignInput
+	defer func() {
+		if err != nil {
+			c.Abandon(inputs)
+		}
+	}()
+	for i := range p.txIns {
+		in, err := p.input(i)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := c.key(hex.EncodeToString(in.internalKey))
+		if !ok {
+			continue
+		}
+		if key.UserKey != pubKey {
+			return nil, fmt.Errorf("%w: input %d", ErrForeignAnchorKey, i)
+		}
+
+		root := in.merkleRoot
+		signers := []string{key.ServerKey.RawKeyBytes, "02" + key.UserKey}
+		if err := checkOutputKey(in.script, signers, root); err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+
+		sighash, err := p.keySpendSighash(i)
+		if err != nil {
+			return nil, err
+		}
+		sessionID, nonce, err := c.signer.CreateSession(&key.ServerKey, signers, root)
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, sessions.CosignInput{
+			InputIndex:    i,
+			InternalKey:   key.InternalKey,
+			ServerKey:     key.ServerKey.RawKeyBytes,
+			MerkleRoot:    hex.EncodeToString(root),
+			SighashHex:    hex.EncodeToString(sighash[:]),
+			ServerNonce:   nonce,
+			SignerSession: sessionID,
+		})
+	}
+	if len(inputs) == 0 {
+		return nil, ErrNothingToCosign
+	}
+	return inputs, nil
+}
+
+// RegisterNonces hands the signer the user's public nonce of every input,
+// keyed by input index, and returns the inputs with them recorded. Nonces
+// are all checked before any is registered.
+func (c *Cosigner) RegisterNonces(inputs []sessions.CosignInput, nonces map[int]string) ([]sessions.CosignInput, error) {
+	for _, input := range inputs {
+		if input.UserNonce != "" {
+			return nil, ErrNoncesAlreadyExist
+		}
+		nonce, ok := nonces[input.InputIndex]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing for input %d", ErrInvalidNonce, input.InputIndex)
+		}
+		if _, err := parseNonce(nonce); err != nil {
+			return nil, fmt.Errorf("%w: input %d: %v", ErrInvalidNonce, input.InputIndex, err)
+		}
+	}
+
+	registered := append([]sessions.CosignInput(nil), inputs...)
+	for i := range registered {
+		nonce := nonces[registered[i].InputIndex]
+		if err := c.signer.RegisterNonce(registered[i].SignerSession, nonce); err != nil {
+			return nil, fmt.Errorf("input %d: %w", registered[i].InputIndex, err)
+		}
+		registered[i].UserNonce = nonce
+	}
+	return registered, nil
+}
+
+// Finish checks the user's partial signature of every input, keyed by input
+// index, then has the server sign and returns the base64 anchor PSBT with
+// those inputs finalized. Nothing is signed by the server unless every
+// partial signature of the user is valid.
+func (c *Cosigner) Finish(pubKey string, cosign *sessions.Cosign, partialSigs map[int]string) (string, error) {
+	p, err := parsePSBT(cosign.AnchorPSBT)
+	if err != nil {
+		return "", err
+	}
+
+	userKey, err := parsePubKeys([]string{"02" + pubKey})
+	if err != nil {
+		return "", err
+	}
+	for _, input := range cosign.Inputs {
+		if input.UserNonce == "" {
+			return "", ErrNoncesMissing
+		}
+		if err := verifyPartialSig(input, userKey[0], partialSigs[input.InputIndex]); err != nil {
+			return "", err
+		}
+	}
+
+	for _, input := range cosign.Inputs {
+		msg, _ := sighash(input)
+		if _, err := c.signer.Sign(input.SignerSession, msg); err != nil {
+			return "", fmt.Errorf("input %d: %w", input.InputIndex, err)
+		}
+		sigHex, err := c.signer.CombineSig(input.SignerSession, partialSigs[input.InputIndex])
+		if err != nil {
+			return "", fmt.Errorf("input %d: %w", input.InputIndex, err)
+		}
+
+		sig, err := hex.DecodeString(sigHex)
+		if err != nil {
+			return "", fmt.Errorf("input %d: %w", input.InputIndex, err)
+		}
+		in, err := p.input(input.InputIndex)
+		if err != nil {
+			return "", err
+		}
+		if err := verifyKeySpend(in.script, msg, sig); err != nil {
+			return "", fmt.Errorf("input %d: %w", input.InputIndex, err)
+		}
+		p.setKeySpendSig(input.InputIndex, sig)
+	}
+
+	return base64.StdEncoding.EncodeToString(p.serialize()), nil
+}
+
+// Abandon drops the server's MuSig2 sessions of inputs that will never be
+// signed. Every session is attempted; the first error is returned.
+func (c *Cosigner) Abandon(inputs []sessions.CosignInput) error {
+	var firstErr error
+	for _, input := range inputs {
+		if input.SignerSession == "" {
+			continue
+		}
+		if err := c.signer.Cleanup(input.SignerSession); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("input %d: %w", input.InputIndex, err)
+		}
+	}
+	return firstErr
+}
+
+func (c *Cosigner) key(internalKey string) (*AnchorKey, bool) {
+	switch len(internalKey) {
+	case 66:
+		return c.keys.Get(internalKey)
+	case 64:
+		// Anchor keys are stored compressed, PSBTs carry them x-only
+		for _, prefix := range []string{"02", "03"} {
+			if key, ok := c.keys.Get(prefix + internalKey); ok {
+				return key, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// checkOutputKey checks script is the P2TR output of the aggregate of
+// signers tweaked with root, or with no script tree when root is empty.
+func checkOutputKey(script []byte, signers []string, root []byte) error {
+	keys, err := parsePubKeys(signers)
+	if err != nil {
+		return err
+	}
+	tweak := musig2.WithBIP86KeyTweak()
+	if len(root) > 0 {
+		tweak = musig2.WithTaprootKeyTweak(root)
+	}
+	tweaked, _, _, err := musig2.AggregateKeys(keys, true, tweak)
+	if err != nil {
+		return err
+	}
+	if len(script) != 34 || script[0] != 0x51 || script[1] != 0x20 ||
+		!bytes.Equal(script[2:], schnorr.SerializePubKey(tweaked.FinalKey)) {
+		return ErrOutputKeyMismatch
+	}
+	return nil
+}
+
+func verifyPartialSig(input sessions.CosignInput, userKey *btcec.PublicKey, partialSigHex string) error {
+	if partialSigHex == "" {
+		return fmt.Errorf("%w: missing for input %d", ErrInvalidPartialSig, input.InputIndex)
+	}
+	partial, err := parsePartialSig(partialSigHex)
+	if err != nil {
+		return fmt.Errorf("%w: input %d: %v", ErrInvalidPartialSig, input.InputIndex, err)
+	}
+
+	serverNonce, err := parseNonce(input.ServerNonce)
+	if err != nil {
+		return err
+	}
+	userNonce, err := parseNonce(input.UserNonce)
+	if err != nil {
+		return err
+	}
+	combinedNonce, err := musig2.AggregateNonces([][musig2.PubNonceSize]byte{serverNonce, userNonce})
+	if err != nil {
+		return err
+	}
+	keys, err := parsePubKeys([]string{input.ServerKey, hex.EncodeToString(userKey.SerializeCompressed())})
+	if err != nil {
+		return err
+	}
+	root, err := hex.DecodeString(input.MerkleRoot)
+	if err != nil {
+		return err
+	}
+	msg, err := sighash(input)
+	if err != nil {
+		return err
+	}
+
+	tweak := musig2.WithBip86SignTweak()
+	if len(root) > 0 {
+		tweak = musig2.WithTaprootSignTweak(root)
+	}
+	if !partial.Verify(userNonce, combinedNonce, keys, userKey, msg, musig2.WithSortedKeys(), tweak) {
+		return fmt.Errorf("%w: input %d", ErrInvalidPartialSig, input.InputIndex)
+	}
+	return nil
+}
+
+// verifyKeySpend checks sig is a valid signature of msg by the output key
+// of the P2TR script.
+func verifyKeySpend(script []byte, msg [32]byte, sig []byte) error {
+	outputKey, err := schnorr.ParsePubKey(script[2:])
+	if err != nil {
+		return err
+	}
+	signature, err := schnorr.ParseSignature(sig)
+	if err != nil || !signature.Verify(msg[:], outputKey) {
+		return ErrFinalSigInvalid
+	}
+	return nil
+}
+
+func sighash(input sessions.CosignInput) ([32]byte, error) {
+	var msg [32]byte
+	raw, err := hex.DecodeString(input.SighashHex)
+	if err != nil || len(raw) != 32 {
+		return msg, fmt.Errorf("invalid sighash of input %d", input.InputIndex)
+	}
+	copy(msg[:], raw)
+	return msg, nil
+}
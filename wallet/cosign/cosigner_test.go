@@ -0,0 +1,283 @@
+package cosign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"tajfi-server/wallet/sessions"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// testUser is the user's side of a MuSig2 anchor key.
+type testUser struct {
+	priv *btcec.PrivateKey
+	// pubKey is the x-only public key in hex, as tajfi knows users
+	pubKey string
+}
+
+// newTestUser returns a user whose key has an even y, the one behind their
+// x-only public key.
+func newTestUser(t *testing.T) testUser {
+	t.Helper()
+	priv, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priv.PubKey().SerializeCompressed()[0] == 0x03 {
+		priv.Key.Negate()
+	}
+	return testUser{priv: priv, pubKey: hex.EncodeToString(schnorr.SerializePubKey(priv.PubKey()))}
+}
+
+func newTestCosigner(t *testing.T) (*Cosigner, *LocalSigner) {
+	t.Helper()
+	keys, err := LoadKeyStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := NewLocalSigner(bytes.Repeat([]byte{0x42}, 32))
+	return NewCosigner(signer, keys), signer
+}
+
+// anchorPSBT returns an anchor PSBT whose input 0 spends the P2TR output of
+// internalKey tweaked with root and whose input 1 is LND's fee input.
+func anchorPSBT(t *testing.T, internalKey string, root []byte) string {
+	t.Helper()
+	key, err := btcec.ParsePubKey(mustHex(t, internalKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputKey := schnorr.SerializePubKey(taprootOutputKey(key, root))
+	anchorScript := append([]byte{0x51, 0x20}, outputKey...)
+
+	var tx bytes.Buffer
+	binary.Write(&tx, binary.LittleEndian, int32(2))
+	writeVarInt(&tx, 2)
+	for i, prev := range [][]byte{bytes.Repeat([]byte{0xaa}, 32), bytes.Repeat([]byte{0xbb}, 32)} {
+		tx.Write(prev)
+		binary.Write(&tx, binary.LittleEndian, uint32(i))
+		writeVarInt(&tx, 0)
+		binary.Write(&tx, binary.LittleEndian, uint32(0xffffffff))
+	}
+	writeVarInt(&tx, 2)
+	for _, value := range []int64{1000, 50000} {
+		binary.Write(&tx, binary.LittleEndian, value)
+		writeVarBytes(&tx, append([]byte{0x51, 0x20}, bytes.Repeat([]byte{0x11}, 32)...))
+	}
+	binary.Write(&tx, binary.LittleEndian, uint32(0))
+
+	anchorIn := []pair{
+		witnessUtxo(1000, anchorScript),
+		{key: []byte{psbtInTapInternalKey}, value: schnorr.SerializePubKey(key)},
+	}
+	if root != nil {
+		anchorIn = append(anchorIn, pair{key: []byte{psbtInTapMerkleRoot}, value: root})
+	}
+	feeIn := []pair{witnessUtxo(60000, append([]byte{0x00, 0x14}, bytes.Repeat([]byte{0x22}, 20)...))}
+	return encodePSBT(tx.Bytes(), nil, [][]pair{anchorIn, feeIn}, make([][]pair, 2))
+}
+
+// taprootOutputKey tweaks key with its commitment to the script root as
+// BIP 341 does, independently of the MuSig2 tweaking under test. An empty
+// root commits to no script tree.
+func taprootOutputKey(key *btcec.PublicKey, root []byte) *btcec.PublicKey {
+	xOnly := schnorr.SerializePubKey(key)
+	evenKey, _ := schnorr.ParsePubKey(xOnly)
+
+	var tweak btcec.ModNScalar
+	tweak.SetByteSlice(chainhash.TaggedHash(chainhash.TagTapTweak, xOnly, root)[:])
+
+	var k, tweakPoint, sum btcec.JacobianPoint
+	evenKey.AsJacobian(&k)
+	btcec.ScalarBaseMultNonConst(&tweak, &tweakPoint)
+	btcec.AddNonConst(&k, &tweakPoint, &sum)
+	sum.ToAffine()
+	return btcec.NewPublicKey(&sum.X, &sum.Y)
+}
+
+// userSign is what the user's wallet does for one cosigned input: it
+// creates a nonce for the aggregate of the server's and its own key and
+// partially signs the input's sighash.
+type userSign struct {
+	session *musig2.Session
+}
+
+func newUserSign(t *testing.T, user testUser, input sessions.CosignInput) *userSign {
+	t.Helper()
+	serverKey, err := btcec.ParsePubKey(mustHex(t, input.ServerKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := musig2.WithBip86TweakCtx()
+	if root := mustHex(t, input.MerkleRoot); len(root) > 0 {
+		tweak = musig2.WithTaprootTweakCtx(root)
+	}
+	ctx, err := musig2.NewContext(user.priv, true,
+		musig2.WithKnownSigners([]*btcec.PublicKey{serverKey, user.priv.PubKey()}), tweak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := ctx.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &userSign{session: session}
+}
+
+func (u *userSign) nonce() string {
+	nonce := u.session.PublicNonce()
+	return hex.EncodeToString(nonce[:])
+}
+
+func (u *userSign) sign(t *testing.T, input sessions.CosignInput) string {
+	t.Helper()
+	serverNonce, err := parseNonce(input.ServerNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.session.RegisterPubNonce(serverNonce); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := sighash(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial, err := u.session.Sign(msg, musig2.WithSortedKeys())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := partial.S.Bytes()
+	return hex.EncodeToString(s[:])
+}
+
+// prepareCosign has the cosigner hand out an anchor key for user, prepares
+// an anchor PSBT spending it and registers the user's nonce.
+func prepareCosign(t *testing.T, cosigner *Cosigner, user testUser, root []byte) (*sessions.Cosign, *userSign) {
+	t.Helper()
+	internalKey, err := cosigner.NewInternalKey(user.pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cosigner.Controls(internalKey.RawKeyBytes) || !cosigner.Controls(internalKey.RawKeyBytes[2:]) {
+		t.Fatal("cosigner does not control the key it handed out")
+	}
+
+	anchor := anchorPSBT(t, internalKey.RawKeyBytes, root)
+	inputs, err := cosigner.Prepare(user.pubKey, anchor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 1 || inputs[0].InputIndex != 0 {
+		t.Fatalf("inputs = %+v, want only the anchor input", inputs)
+	}
+
+	u := newUserSign(t, user, inputs[0])
+	inputs, err = cosigner.RegisterNonces(inputs, map[int]string{0: u.nonce()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sessions.Cosign{AnchorPSBT: anchor, Inputs: inputs}, u
+}
+
+func TestCosignRoundTrip(t *testing.T) {
+	for name, root := range map[string][]byte{
+		"script root": bytes.Repeat([]byte{0x07}, 32),
+		"key only":    nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			cosigner, signer := newTestCosigner(t)
+			user := newTestUser(t)
+			cosigning, u := prepareCosign(t, cosigner, user, root)
+
+			partial := u.sign(t, cosigning.Inputs[0])
+			signed, err := cosigner.Finish(user.pubKey, cosigning, map[int]string{0: partial})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := parsePSBT(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			in, err := p.input(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var witness []byte
+			for _, kv := range p.inputs[0] {
+				if len(kv.key) == 1 && kv.key[0] == psbtInFinalWitness {
+					witness = kv.value
+				}
+			}
+			if len(witness) != 66 || witness[0] != 0x01 || witness[1] != 0x40 {
+				t.Fatalf("final witness = %x, want one 64-byte signature", witness)
+			}
+			msg, _ := p.keySpendSighash(0)
+			if err := verifyKeySpend(in.script, msg, witness[2:]); err != nil {
+				t.Fatal(err)
+			}
+
+			// The server's session is gone once signed
+			if _, err := signer.session(cosigning.Inputs[0].SignerSession); !errors.Is(err, ErrUnknownSession) {
+				t.Fatalf("signer session err = %v, want ErrUnknownSession", err)
+			}
+		})
+	}
+}
+
+func TestFinishRejectsBadPartialSig(t *testing.T) {
+	cosigner, _ := newTestCosigner(t)
+	user := newTestUser(t)
+	cosigning, u := prepareCosign(t, cosigner, user, bytes.Repeat([]byte{0x07}, 32))
+
+	partial := u.sign(t, cosigning.Inputs[0])
+	raw := mustHex(t, partial)
+	raw[31] ^= 0x01
+	for name, sigs := range map[string]map[int]string{
+		"tampered": {0: hex.EncodeToString(raw)},
+		"missing":  {},
+		"garbage":  {0: "zz"},
+	} {
+		if _, err := cosigner.Finish(user.pubKey, cosigning, sigs); !errors.Is(err, ErrInvalidPartialSig) {
+			t.Fatalf("%s: err = %v, want ErrInvalidPartialSig", name, err)
+		}
+	}
+
+	// Nothing was signed by the server, so the right signature still works
+	if _, err := cosigner.Finish(user.pubKey, cosigning, map[int]string{0: partial}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrepareRejectsOtherUsersKey(t *testing.T) {
+	cosigner, _ := newTestCosigner(t)
+	owner, other := newTestUser(t), newTestUser(t)
+
+	internalKey, err := cosigner.NewInternalKey(owner.pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchor := anchorPSBT(t, internalKey.RawKeyBytes, nil)
+	if _, err := cosigner.Prepare(other.pubKey, anchor); !errors.Is(err, ErrForeignAnchorKey) {
+		t.Fatalf("err = %v, want ErrForeignAnchorKey", err)
+	}
+}
+
+func TestAbandonDropsSignerSessions(t *testing.T) {
+	cosigner, signer := newTestCosigner(t)
+	user := newTestUser(t)
+	cosigning, _ := prepareCosign(t, cosigner, user, nil)
+
+	if err := cosigner.Abandon(cosigning.Inputs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.session(cosigning.Inputs[0].SignerSession); !errors.Is(err, ErrUnknownSession) {
+		t.Fatalf("signer session err = %v, want ErrUnknownSession", err)
+	}
+}
@@ -0,0 +1,108 @@
+package cosign
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"tajfi-server/wallet/lnd"
+	"time"
+)
+
+// AnchorKey is a MuSig2 anchor internal key handed out for one user: the
+// aggregate of a server key and the user's key.
+type AnchorKey struct {
+	// InternalKey is the 33-byte compressed aggregate key in hex
+	InternalKey string `json:"internal_key"`
+	// UserKey is the user's x-only public key in hex
+	UserKey   string                  `json:"user_key"`
+	ServerKey lnd.InternalKeyResponse `json:"server_key"`
+	CreatedAt time.Time               `json:"created_at"`
+}
+
+// KeyStore keeps the anchor keys handed out in memory and, when path is
+// set, persists them to a JSON file. Losing it means the server can no
+// longer tell which anchor outputs it has to co-sign.
+type KeyStore struct {
+	mu   sync.RWMutex
+	path string
+	keys map[string]*AnchorKey
+}
+
+// LoadKeyStore opens the key store at path, which may not exist yet. An
+// empty path keeps keys in memory only.
+func LoadKeyStore(path string) (*KeyStore, error) {
+	s := &KeyStore{path: path, keys: make(map[string]*AnchorKey)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []AnchorKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i := range stored {
+		s.keys[stored[i].InternalKey] = &stored[i]
+	}
+	return s, nil
+}
+
+// Get returns the anchor key with the given compressed internal key.
+func (s *KeyStore) Get(internalKey string) (*AnchorKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[internalKey]
+	if !ok {
+		return nil, false
+	}
+	k := *key
+	return &k, true
+}
+
+// Add records a new anchor key.
+func (s *KeyStore) Add(key AnchorKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.InternalKey] = &key
+	if err := s.saveLocked(); err != nil {
+		delete(s.keys, key.InternalKey)
+		return err
+	}
+	return nil
+}
+
+func (s *KeyStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	stored := make([]AnchorKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		stored = append(stored, *key)
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].CreatedAt.Before(stored[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write MuSig2 keys: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,95 @@
+package cosign
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"tajfi-server/wallet/lnd"
+)
+
+// LNDSigner is a Signer backed by LND's MuSig2 signer RPCs, so the server's
+// keys never leave LND.
+type LNDSigner struct {
+	host     string
+	macaroon string
+}
+
+func NewLNDSigner(lndHost, macaroon string) *LNDSigner {
+	return &LNDSigner{host: lndHost, macaroon: macaroon}
+}
+
+func (s *LNDSigner) NewKey() (*lnd.InternalKeyResponse, error) {
+	return lnd.GetInternalKey(s.host, s.macaroon)
+}
+
+func (s *LNDSigner) CreateSession(key *lnd.InternalKeyResponse, signers []string, merkleRoot []byte) (string, string, error) {
+	request := lnd.MuSig2CreateSessionRequest{
+		KeyLoc: lnd.KeyLocator{
+			KeyFamily: key.KeyLoc.KeyFamily,
+			KeyIndex:  key.KeyLoc.KeyIndex,
+		},
+		Version: lnd.MuSig2Version,
+	}
+	for _, signer := range signers {
+		raw, err := hex.DecodeString(signer)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid public key %q: %w", signer, err)
+		}
+		request.AllSignerPubkeys = append(request.AllSignerPubkeys, base64.StdEncoding.EncodeToString(raw))
+	}
+	if len(merkleRoot) > 0 {
+		request.TaprootTweak.ScriptRoot = base64.StdEncoding.EncodeToString(merkleRoot)
+	} else {
+		request.TaprootTweak.KeySpendOnly = true
+	}
+
+	session, err := lnd.MuSig2CreateSession(s.host, s.macaroon, request)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(session.LocalPublicNonces)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode LND's public nonce: %w", err)
+	}
+	return session.SessionID, hex.EncodeToString(nonce), nil
+}
+
+func (s *LNDSigner) RegisterNonce(sessionID, nonce string) error {
+	raw, err := hex.DecodeString(nonce)
+	if err != nil {
+		return fmt.Errorf("invalid public nonce: %w", err)
+	}
+	return lnd.MuSig2RegisterNonces(s.host, s.macaroon, sessionID, []string{base64.StdEncoding.EncodeToString(raw)})
+}
+
+func (s *LNDSigner) Sign(sessionID string, msg [32]byte) (string, error) {
+	partial, err := lnd.MuSig2Sign(s.host, s.macaroon, sessionID, base64.StdEncoding.EncodeToString(msg[:]))
+	if err != nil {
+		return "", err
+	}
+	raw, err := base64.StdEncoding.DecodeString(partial)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode LND's partial signature: %w", err)
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func (s *LNDSigner) CombineSig(sessionID, partialSig string) (string, error) {
+	raw, err := hex.DecodeString(partialSig)
+	if err != nil {
+		return "", fmt.Errorf("invalid partial signature: %w", err)
+	}
+	sig, err := lnd.MuSig2CombineSig(s.host, s.macaroon, sessionID, []string{base64.StdEncoding.EncodeToString(raw)})
+	if err != nil {
+		return "", err
+	}
+	final, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode LND's final signature: %w", err)
+	}
+	return hex.EncodeToString(final), nil
+}
+
+func (s *LNDSigner) Cleanup(sessionID string) error {
+	return lnd.MuSig2Cleanup(s.host, s.macaroon, sessionID)
+}
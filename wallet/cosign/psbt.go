@@ -0,0 +1,366 @@
+package cosign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// PSBT key types used here, from BIP 174 and BIP 371
+const (
+	psbtGlobalUnsignedTx = 0x00
+	psbtInWitnessUtxo    = 0x01
+	psbtInFinalWitness   = 0x08
+	psbtInTapInternalKey = 0x17
+	psbtInTapMerkleRoot  = 0x18
+	psbtSeparator        = 0x00
+)
+
+var (
+	psbtMagic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+	ErrInvalidPSBT = errors.New("invalid anchor PSBT")
+)
+
+type txIn struct {
+	prevHash  [32]byte
+	prevIndex uint32
+	sequence  uint32
+}
+
+type txOut struct {
+	value  int64
+	script []byte
+}
+
+type pair struct {
+	key   []byte
+	value []byte
+}
+
+// packet is a parsed PSBT. Only the fields needed to sign taproot key
+// spends are interpreted, everything else is kept as is.
+type packet struct {
+	version  int32
+	lockTime uint32
+	txIns    []txIn
+	txOuts   []txOut
+	global   []pair
+	inputs   [][]pair
+	outputs  [][]pair
+}
+
+// anchorInput is what an anchor PSBT input says about the output it spends.
+type anchorInput struct {
+	value       int64
+	script      []byte
+	internalKey []byte
+	merkleRoot  []byte
+}
+
+func parsePSBT(b64 string) (*packet, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPSBT, err)
+	}
+	r := bytes.NewReader(raw)
+
+	magic := make([]byte, len(psbtMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, psbtMagic) {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidPSBT)
+	}
+
+	p := &packet{}
+	if p.global, err = readMap(r); err != nil {
+		return nil, err
+	}
+	var unsignedTx []byte
+	for _, kv := range p.global {
+		if len(kv.key) == 1 && kv.key[0] == psbtGlobalUnsignedTx {
+			unsignedTx = kv.value
+		}
+	}
+	if unsignedTx == nil {
+		return nil, fmt.Errorf("%w: no unsigned transaction", ErrInvalidPSBT)
+	}
+	if err := p.parseTx(unsignedTx); err != nil {
+		return nil, err
+	}
+
+	for range p.txIns {
+		m, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		p.inputs = append(p.inputs, m)
+	}
+	for range p.txOuts {
+		m, err := readMap(r)
+		if err != nil {
+			return nil, err
+		}
+		p.outputs = append(p.outputs, m)
+	}
+	return p, nil
+}
+
+func (p *packet) parseTx(tx []byte) error {
+	r := bytes.NewReader(tx)
+	fail := func(err error) error {
+		return fmt.Errorf("%w: unsigned transaction: %v", ErrInvalidPSBT, err)
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &p.version); err != nil {
+		return fail(err)
+	}
+	count, err := readVarInt(r)
+	if err != nil {
+		return fail(err)
+	}
+	for i := uint64(0); i < count; i++ {
+		var in txIn
+		if _, err := io.ReadFull(r, in.prevHash[:]); err != nil {
+			return fail(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &in.prevIndex); err != nil {
+			return fail(err)
+		}
+		if _, err := readVarBytes(r); err != nil {
+			return fail(err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &in.sequence); err != nil {
+			return fail(err)
+		}
+		p.txIns = append(p.txIns, in)
+	}
+	if count, err = readVarInt(r); err != nil {
+		return fail(err)
+	}
+	for i := uint64(0); i < count; i++ {
+		var out txOut
+		if err := binary.Read(r, binary.LittleEndian, &out.value); err != nil {
+			return fail(err)
+		}
+		if out.script, err = readVarBytes(r); err != nil {
+			return fail(err)
+		}
+		p.txOuts = append(p.txOuts, out)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &p.lockTime); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+func (p *packet) serializeTx() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, p.version)
+	writeVarInt(&buf, uint64(len(p.txIns)))
+	for _, in := range p.txIns {
+		buf.Write(in.prevHash[:])
+		binary.Write(&buf, binary.LittleEndian, in.prevIndex)
+		writeVarInt(&buf, 0)
+		binary.Write(&buf, binary.LittleEndian, in.sequence)
+	}
+	writeVarInt(&buf, uint64(len(p.txOuts)))
+	for _, out := range p.txOuts {
+		binary.Write(&buf, binary.LittleEndian, out.value)
+		writeVarBytes(&buf, out.script)
+	}
+	binary.Write(&buf, binary.LittleEndian, p.lockTime)
+	return buf.Bytes()
+}
+
+func (p *packet) serialize() []byte {
+	var buf bytes.Buffer
+	buf.Write(psbtMagic)
+
+	global := []pair{{key: []byte{psbtGlobalUnsignedTx}, value: p.serializeTx()}}
+	for _, kv := range p.global {
+		if len(kv.key) == 1 && kv.key[0] == psbtGlobalUnsignedTx {
+			continue
+		}
+		global = append(global, kv)
+	}
+	writeMap(&buf, global)
+	for _, m := range p.inputs {
+		writeMap(&buf, m)
+	}
+	for _, m := range p.outputs {
+		writeMap(&buf, m)
+	}
+	return buf.Bytes()
+}
+
+// input returns the fields of input i needed to sign a key spend of it.
+func (p *packet) input(i int) (*anchorInput, error) {
+	if i < 0 || i >= len(p.inputs) {
+		return nil, fmt.Errorf("%w: no input %d", ErrInvalidPSBT, i)
+	}
+
+	in := &anchorInput{}
+	for _, kv := range p.inputs[i] {
+		if len(kv.key) != 1 {
+			continue
+		}
+		switch kv.key[0] {
+		case psbtInWitnessUtxo:
+			r := bytes.NewReader(kv.value)
+			if err := binary.Read(r, binary.LittleEndian, &in.value); err != nil {
+				return nil, fmt.Errorf("%w: input %d witness utxo: %v", ErrInvalidPSBT, i, err)
+			}
+			script, err := readVarBytes(r)
+			if err != nil {
+				return nil, fmt.Errorf("%w: input %d witness utxo: %v", ErrInvalidPSBT, i, err)
+			}
+			in.script = script
+		case psbtInTapInternalKey:
+			in.internalKey = kv.value
+		case psbtInTapMerkleRoot:
+			in.merkleRoot = kv.value
+		}
+	}
+	if in.script == nil {
+		return nil, fmt.Errorf("%w: input %d has no witness utxo", ErrInvalidPSBT, i)
+	}
+	return in, nil
+}
+
+// setKeySpendSig finalizes input i with a taproot key spend signature.
+func (p *packet) setKeySpendSig(i int, sig []byte) {
+	var witness bytes.Buffer
+	writeVarInt(&witness, 1)
+	writeVarBytes(&witness, sig)
+
+	var kept []pair
+	for _, kv := range p.inputs[i] {
+		if len(kv.key) == 1 && kv.key[0] == psbtInFinalWitness {
+			continue
+		}
+		kept = append(kept, kv)
+	}
+	p.inputs[i] = append(kept, pair{key: []byte{psbtInFinalWitness}, value: witness.Bytes()})
+}
+
+// keySpendSighash computes the BIP 341 SIGHASH_DEFAULT message of a key
+// spend of input i. Every input must carry its witness utxo.
+func (p *packet) keySpendSighash(i int) ([32]byte, error) {
+	var prevouts, amounts, scripts, sequences, outputs bytes.Buffer
+	for j, in := range p.txIns {
+		spent, err := p.input(j)
+		if err != nil {
+			return [32]byte{}, err
+		}
+		prevouts.Write(in.prevHash[:])
+		binary.Write(&prevouts, binary.LittleEndian, in.prevIndex)
+		binary.Write(&amounts, binary.LittleEndian, spent.value)
+		writeVarBytes(&scripts, spent.script)
+		binary.Write(&sequences, binary.LittleEndian, in.sequence)
+	}
+	for _, out := range p.txOuts {
+		binary.Write(&outputs, binary.LittleEndian, out.value)
+		writeVarBytes(&outputs, out.script)
+	}
+
+	var msg bytes.Buffer
+	msg.WriteByte(0x00) // sighash epoch
+	msg.WriteByte(0x00) // SIGHASH_DEFAULT
+	binary.Write(&msg, binary.LittleEndian, p.version)
+	binary.Write(&msg, binary.LittleEndian, p.lockTime)
+	for _, field := range []*bytes.Buffer{&prevouts, &amounts, &scripts, &sequences, &outputs} {
+		sum := sha256.Sum256(field.Bytes())
+		msg.Write(sum[:])
+	}
+	msg.WriteByte(0x00) // key path, no annex
+	binary.Write(&msg, binary.LittleEndian, uint32(i))
+
+	return *chainhash.TaggedHash(chainhash.TagTapSighash, msg.Bytes()), nil
+}
+
+func readMap(r *bytes.Reader) ([]pair, error) {
+	var m []pair
+	for {
+		key, err := readVarBytes(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPSBT, err)
+		}
+		if len(key) == 0 {
+			return m, nil
+		}
+		value, err := readVarBytes(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPSBT, err)
+		}
+		m = append(m, pair{key: key, value: value})
+	}
+}
+
+func writeMap(w *bytes.Buffer, m []pair) {
+	for _, kv := range m {
+		writeVarBytes(w, kv.key)
+		writeVarBytes(w, kv.value)
+	}
+	w.WriteByte(psbtSeparator)
+}
+
+func readVarInt(r *bytes.Reader) (uint64, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch prefix {
+	case 0xfd:
+		var v uint16
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return uint64(v), err
+	case 0xfe:
+		var v uint32
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return uint64(v), err
+	case 0xff:
+		var v uint64
+		err = binary.Read(r, binary.LittleEndian, &v)
+		return v, err
+	}
+	return uint64(prefix), nil
+}
+
+func readVarBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+func writeVarInt(w *bytes.Buffer, n uint64) {
+	switch {
+	case n < 0xfd:
+		w.WriteByte(byte(n))
+	case n <= 0xffff:
+		w.WriteByte(0xfd)
+		binary.Write(w, binary.LittleEndian, uint16(n))
+	case n <= 0xffffffff:
+		w.WriteByte(0xfe)
+		binary.Write(w, binary.LittleEndian, uint32(n))
+	default:
+		w.WriteByte(0xff)
+		binary.Write(w, binary.LittleEndian, n)
+	}
+}
+
+func writeVarBytes(w *bytes.Buffer, b []byte) {
+	writeVarInt(w, uint64(len(b)))
+	w.Write(b)
+}
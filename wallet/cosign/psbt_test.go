@@ -0,0 +1,172 @@
+package cosign
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// bip341UnsignedTx and bip341Spent are the transaction and spent outputs
+// of the keyPathSpending case of BIP 341's wallet test vectors.
+const bip341UnsignedTx = "02000000097de20cbff686da83a54981d2b9bab3586f4ca7e48f57f5b55963115f3b334e9c010000000000000000d7b7cab57b1393ace2d064f4d4a2cb8af6def61273e127517d44759b6dafdd990000000000fffffffff8e1f583384333689228c5d28eac13366be082dc57441760d957275419a418420000000000fffffffff0689180aa63b30cb162a73c6d2a38b7eeda2a83ece74310fda0843ad604853b0100000000feffffffaa5202bdf6d8ccd2ee0f0202afbbb7461d9264a25e5bfd3c5a52ee1239e0ba6c0000000000feffffff956149bdc66faa968eb2be2d2faa29718acbfe3941215893a2a3446d32acd050000000000000000000e664b9773b88c09c32cb70a2a3e4da0ced63b7ba3b22f848531bbb1d5d5f4c94010000000000000000e9aa6b8e6c9de67619e6a3924ae25696bb7b694bb677a632a74ef7eadfd4eabf0000000000ffffffffa778eb6a263dc090464cd125c466b5a99667720b1c110468831d058aa1b82af10100000000ffffffff0200ca9a3b000000001976a91406afd46bcdfd22ef94ac122aa11f241244a37ecc88ac807840cb0000000020ac9a87f5594be208f8532db38cff670c450ed2fea8fcdefcc9a663f78bab962b0065cd1d"
+
+var bip341Spent = []struct {
+	script string
+	value  int64
+}{
+	{"512053a1f6e454df1aa2776a2814a721372d6258050de330b3c6d10ee8f4e0dda343", 420000000},
+	{"5120147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3", 462000000},
+	{"76a914751e76e8199196d454941c45d1b3a323f1433bd688ac", 294000000},
+	{"5120e4d810fd50586274face62b8a807eb9719cef49c04177cc6b76a9a4251d5450e", 504000000},
+	{"512091b64d5324723a985170e4dc5a0f84c041804f2cd12660fa5dec09fc21783605", 630000000},
+	{"00147dd65592d0ab2fe0d0257d571abf032cd9db93dc", 378000000},
+	{"512075169f4001aa68f15bbed28b218df1d0a62cbbcf1188c6665110c293c907b831", 672000000},
+	{"5120712447206d7a5238acc7ff53fbe94a3b64539ad291c7cdbc490b7577e4b17df5", 546000000},
+	{"512077e30a5522dd9f894c3f8b8bd4c4b2cf82ca7da8a3ea6a239655c39c050ab220", 588000000},
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+func witnessUtxo(value int64, script []byte) pair {
+	var v bytes.Buffer
+	binary.Write(&v, binary.LittleEndian, value)
+	writeVarBytes(&v, script)
+	return pair{key: []byte{psbtInWitnessUtxo}, value: v.Bytes()}
+}
+
+// encodePSBT builds a base64 PSBT from an unsigned transaction and the maps
+// of its global section, inputs and outputs.
+func encodePSBT(unsignedTx []byte, global []pair, inputs, outputs [][]pair) string {
+	var buf bytes.Buffer
+	buf.Write(psbtMagic)
+	writeMap(&buf, append([]pair{{key: []byte{psbtGlobalUnsignedTx}, value: unsignedTx}}, global...))
+	for _, m := range inputs {
+		writeMap(&buf, m)
+	}
+	for _, m := range outputs {
+		writeMap(&buf, m)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func bip341PSBT(t *testing.T) string {
+	t.Helper()
+	inputs := make([][]pair, len(bip341Spent))
+	for i, spent := range bip341Spent {
+		inputs[i] = []pair{witnessUtxo(spent.value, mustHex(t, spent.script))}
+	}
+	return encodePSBT(mustHex(t, bip341UnsignedTx), nil, inputs, make([][]pair, 2))
+}
+
+func TestKeySpendSighashBIP341(t *testing.T) {
+	p, err := parsePSBT(bip341PSBT(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Input 4 is the vectors' only key spend with SIGHASH_DEFAULT
+	sighash, err := p.keySpendSighash(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "4f900a0bae3f1446fd48490c2958b5a023228f01661cda3496a11da502a7f7ef"
+	if got := hex.EncodeToString(sighash[:]); got != want {
+		t.Fatalf("sighash = %s, want %s", got, want)
+	}
+}
+
+func TestKeySpendSighashNeedsWitnessUtxos(t *testing.T) {
+	tx := mustHex(t, bip341UnsignedTx)
+	p, err := parsePSBT(encodePSBT(tx, nil, make([][]pair, len(bip341Spent)), make([][]pair, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.keySpendSighash(0); !errors.Is(err, ErrInvalidPSBT) {
+		t.Fatalf("err = %v, want ErrInvalidPSBT", err)
+	}
+}
+
+func TestPSBTRoundTrip(t *testing.T) {
+	unknown := pair{key: []byte{0xfc, 0x01, 0x02}, value: []byte("kept as is")}
+	tx := mustHex(t, bip341UnsignedTx)
+	inputs := make([][]pair, len(bip341Spent))
+	for i, spent := range bip341Spent {
+		inputs[i] = []pair{witnessUtxo(spent.value, mustHex(t, spent.script)), unknown}
+	}
+	inputs[0] = append(inputs[0],
+		pair{key: []byte{psbtInTapInternalKey}, value: bytes.Repeat([]byte{0x02}, 32)},
+		pair{key: []byte{psbtInTapMerkleRoot}, value: bytes.Repeat([]byte{0x03}, 32)},
+	)
+	outputs := [][]pair{{unknown}, nil}
+
+	for name, b64 := range map[string]string{
+		"bip341":  bip341PSBT(t),
+		"unknown": encodePSBT(tx, []pair{unknown}, inputs, outputs),
+	} {
+		p, err := parsePSBT(b64)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := base64.StdEncoding.EncodeToString(p.serialize()); got != b64 {
+			t.Fatalf("%s: serialized PSBT differs from the parsed one", name)
+		}
+		if got := hex.EncodeToString(p.serializeTx()); got != bip341UnsignedTx {
+			t.Fatalf("%s: unsigned transaction = %s", name, got)
+		}
+	}
+
+	p, err := parsePSBT(encodePSBT(tx, nil, inputs, outputs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := p.input(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if in.value != bip341Spent[0].value || hex.EncodeToString(in.script) != bip341Spent[0].script ||
+		!bytes.Equal(in.internalKey, bytes.Repeat([]byte{0x02}, 32)) || !bytes.Equal(in.merkleRoot, bytes.Repeat([]byte{0x03}, 32)) {
+		t.Fatalf("input 0 = %+v", in)
+	}
+
+	// A key spend signature replaces any earlier final witness
+	sig := bytes.Repeat([]byte{0x04}, 64)
+	p.setKeySpendSig(0, bytes.Repeat([]byte{0x05}, 64))
+	p.setKeySpendSig(0, sig)
+	reparsed, err := parsePSBT(base64.StdEncoding.EncodeToString(p.serialize()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var witnesses [][]byte
+	for _, kv := range reparsed.inputs[0] {
+		if len(kv.key) == 1 && kv.key[0] == psbtInFinalWitness {
+			witnesses = append(witnesses, kv.value)
+		}
+	}
+	want := append([]byte{0x01, 0x40}, sig...)
+	if len(witnesses) != 1 || !bytes.Equal(witnesses[0], want) {
+		t.Fatalf("final witnesses = %x", witnesses)
+	}
+}
+
+func TestParsePSBTRejectsGarbage(t *testing.T) {
+	for name, b64 := range map[string]string{
+		"not base64": "%%%",
+		"bad magic":  base64.StdEncoding.EncodeToString([]byte("psbu\xff\x00")),
+		"no tx":      base64.StdEncoding.EncodeToString(append(append([]byte{}, psbtMagic...), 0x00)),
+		"truncated":  bip341PSBT(t)[:40],
+	} {
+		if _, err := parsePSBT(b64); !errors.Is(err, ErrInvalidPSBT) {
+			t.Errorf("%s: err = %v, want ErrInvalidPSBT", name, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package cosign
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"tajfi-server/wallet/lnd"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// localKeyFamily is the key family of the keys LocalSigner derives, the one
+// tapd takes LND's internal keys from.
+const localKeyFamily = 212
+
+var ErrUnknownSession = errors.New("unknown MuSig2 signing session")
+
+// Signer holds the server's share of MuSig2 anchor keys and signs with it.
+// Keys, nonces and signatures are hex encoded; public keys are 33-byte
+// compressed and partial signatures are the 32-byte s value.
+type Signer interface {
+	// NewKey returns a fresh server key. Its locator is all the signer
+	// needs to sign with it later.
+	NewKey() (*lnd.InternalKeyResponse, error)
+	// CreateSession starts signing with key for the aggregate of signers,
+	// tweaked with the taproot merkleRoot, and returns the server's public
+	// nonce.
+	CreateSession(key *lnd.InternalKeyResponse, signers []string, merkleRoot []byte) (sessionID, nonce string, err error)
+	// RegisterNonce hands the signer the other signer's public nonce.
+	RegisterNonce(sessionID, nonce string) error
+	// Sign creates the server's partial signature of msg.
+	Sign(sessionID string, msg [32]byte) (string, error)
+	// CombineSig combines the server's partial signature with the other
+	// signer's into the final 64-byte schnorr signature.
+	CombineSig(sessionID, partialSig string) (string, error)
+	// Cleanup drops a session that will not be signed, with its secret
+	// nonce.
+	Cleanup(sessionID string) error
+}
+
+// LocalSigner is a Signer keeping the server's keys in process, derived
+// from a seed. It is meant for development and testing against a node
+// without a MuSig2 capable signer.
+type LocalSigner struct {
+	mu       sync.Mutex
+	seed     []byte
+	sessions map[string]*musig2.Session
+}
+
+func NewLocalSigner(seed []byte) *LocalSigner {
+	return &LocalSigner{
+		seed:     seed,
+		sessions: make(map[string]*musig2.Session),
+	}
+}
+
+func (s *LocalSigner) NewKey() (*lnd.InternalKeyResponse, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(1<<31))
+	if err != nil {
+		return nil, fmt.Errorf("failed to pick key index: %w", err)
+	}
+
+	key := &lnd.InternalKeyResponse{}
+	key.KeyLoc.KeyFamily = localKeyFamily
+	key.KeyLoc.KeyIndex = int(index.Int64())
+	key.RawKeyBytes = hex.EncodeToString(s.privKey(key).PubKey().SerializeCompressed())
+	return key, nil
+}
+
+func (s *LocalSigner) CreateSession(key *lnd.InternalKeyResponse, signers []string, merkleRoot []byte) (string, string, error) {
+	keys, err := parsePubKeys(signers)
+	if err != nil {
+		return "", "", err
+	}
+
+	// An empty merkle root means a key spend only output, tweaked as in
+	// BIP 86
+	tweak := musig2.WithBip86TweakCtx()
+	if len(merkleRoot) > 0 {
+		tweak = musig2.WithTaprootTweakCtx(merkleRoot)
+	}
+	ctx, err := musig2.NewContext(s.privKey(key), true, musig2.WithKnownSigners(keys), tweak)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create MuSig2 context: %w", err)
+	}
+	session, err := ctx.NewSession()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create MuSig2 session: %w", err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	sessionID := hex.EncodeToString(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[sessionID] = session
+	nonce := session.PublicNonce()
+	return sessionID, hex.EncodeToString(nonce[:]), nil
+}
+
+func (s *LocalSigner) RegisterNonce(sessionID, nonce string) error {
+	session, err := s.session(sessionID)
+	if err != nil {
+		return err
+	}
+	pubNonce, err := parseNonce(nonce)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = session.RegisterPubNonce(pubNonce)
+	return err
+}
+
+func (s *LocalSigner) Sign(sessionID string, msg [32]byte) (string, error) {
+	session, err := s.session(sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	partial, err := session.Sign(msg, musig2.WithSortedKeys())
+	if err != nil {
+		return "", err
+	}
+	sBytes := partial.S.Bytes()
+	return hex.EncodeToString(sBytes[:]), nil
+}
+
+func (s *LocalSigner) CombineSig(sessionID, partialSig string) (string, error) {
+	session, err := s.session(sessionID)
+	if err != nil {
+		return "", err
+	}
+	partial, err := parsePartialSig(partialSig)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := session.CombineSig(partial); err != nil {
+		return "", err
+	}
+	delete(s.sessions, sessionID)
+	return hex.EncodeToString(session.FinalSig().Serialize()), nil
+}
+
+func (s *LocalSigner) Cleanup(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+func (s *LocalSigner) session(sessionID string) (*musig2.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, ErrUnknownSession
+	}
+	return session, nil
+}
+
+// privKey derives the private key at a key's locator from the seed.
+func (s *LocalSigner) privKey(key *lnd.InternalKeyResponse) *btcec.PrivateKey {
+	loc := make([]byte, 8)
+	binary.BigEndian.PutUint32(loc, uint32(key.KeyLoc.KeyFamily))
+	binary.BigEndian.PutUint32(loc[4:], uint32(key.KeyLoc.KeyIndex))
+	digest := chainhash.TaggedHash([]byte("tajfi/musig2/key"), s.seed, loc)
+	priv, _ := btcec.PrivKeyFromBytes(digest[:])
+	return priv
+}
+
+func parsePubKeys(keysHex []string) ([]*btcec.PublicKey, error) {
+	keys := make([]*btcec.PublicKey, 0, len(keysHex))
+	for _, keyHex := range keysHex {
+		raw, err := hex.DecodeString(keyHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %q: %w", keyHex, err)
+		}
+		key, err := btcec.ParsePubKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %q: %w", keyHex, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func parseNonce(nonceHex string) ([musig2.PubNonceSize]byte, error) {
+	var nonce [musig2.PubNonceSize]byte
+	raw, err := hex.DecodeString(nonceHex)
+	if err != nil || len(raw) != musig2.PubNonceSize {
+		return nonce, fmt.Errorf("public nonce must be %d bytes in hex", musig2.PubNonceSize)
+	}
+	copy(nonce[:], raw)
+	return nonce, nil
+}
+
+func parsePartialSig(sigHex string) (*musig2.PartialSignature, error) {
+	raw, err := hex.DecodeString(sigHex)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("partial signature must be 32 bytes in hex")
+	}
+	var scalar btcec.ModNScalar
+	if overflow := scalar.SetByteSlice(raw); overflow {
+		return nil, fmt.Errorf("partial signature is out of range")
+	}
+	return &musig2.PartialSignature{S: &scalar}, nil
+}
@@ -0,0 +1,390 @@
+package feebump
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"tajfi-server/wallet/lnd"
+	"tajfi-server/wallet/tapd"
+	"time"
+)
+
+var (
+	ErrAnchorNotFound  = errors.New("no unconfirmed anchor transaction with that txid")
+	ErrNoWalletOutput  = errors.New("LND's wallet has no unconfirmed output of that transaction to spend")
+	ErrFeeRateTooLow   = errors.New("fee rate must be higher than the previous bump")
+	ErrFeeRateTooHigh  = errors.New("fee rate is above MaxFeeRate")
+	errNothingToAnchor = errors.New("transfer has no anchor outputs")
+)
+
+// Bump is one CPFP child LND was asked to publish for an anchor
+// transaction.
+type Bump struct {
+	// Outpoint is the output of the anchor transaction the child spends
+	Outpoint string    `json:"outpoint,omitempty"`
+	FeeRate  uint64    `json:"fee_rate"` // sat/vB of the child
+	Auto     bool      `json:"auto"`
+	Status   string    `json:"status,omitempty"` // as reported by LND
+	Error    string    `json:"error,omitempty"`
+	BumpedAt time.Time `json:"bumped_at"`
+}
+
+// Anchor is an anchor transaction that has stayed unconfirmed for too long,
+// or that was fee bumped.
+type Anchor struct {
+	Txid         string    `json:"txid"`
+	PendingSince time.Time `json:"pending_since"`
+	Stuck        bool      `json:"stuck"`
+	Confirmed    bool      `json:"confirmed"`
+	Bumps        []Bump    `json:"bumps,omitempty"`
+
+	// assetOutputs are the outpoints of the anchor transaction that carry
+	// assets, which a CPFP child must never spend
+	assetOutputs map[string]bool
+}
+
+// LastBump returns the most recent successful bump of the anchor, if any.
+func (a *Anchor) LastBump() *Bump {
+	for i := len(a.Bumps) - 1; i >= 0; i-- {
+		if a.Bumps[i].Error == "" {
+			return &a.Bumps[i]
+		}
+	}
+	return nil
+}
+
+// Options configures a Bumper.
+type Options struct {
+	TapdHost     string
+	TapdMacaroon string
+	LNDHost      string
+	LNDMacaroon  string
+	// StuckAfter is how long an anchor transaction may stay unconfirmed
+	// before it is flagged, and how long to wait between automatic bumps
+	StuckAfter time.Duration
+	Auto       bool
+	// MaxAttempts caps automatic bumps of one anchor transaction
+	MaxAttempts int
+	MaxFeeRate  uint64 // sat/vB, 0 for no cap
+	// Estimate returns the fee rate in sat/vB to bump to when none is given
+	Estimate func() (uint64, error)
+}
+
+// Bumper polls tapd's transfers for anchor transactions that stay
+// unconfirmed, flags them and, when enabled, has LND fee bump them with a
+// child spending their change (CPFP).
+type Bumper struct {
+	mu         sync.Mutex
+	tapdClient tapd.TapdClientInterface
+	opts       Options
+	anchors    map[string]*Anchor
+}
+
+func NewBumper(tapdClient tapd.TapdClientInterface, opts Options) *Bumper {
+	return &Bumper{
+		tapdClient: tapdClient,
+		opts:       opts,
+		anchors:    make(map[string]*Anchor),
+	}
+}
+
+// Run checks for stuck anchor transactions every interval until the process
+// exits. A zero interval disables the bumper.
+func (b *Bumper) Run(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := b.Check(now); err != nil {
+			log.Printf("Failed to check anchor transactions: %v", err)
+		}
+	}
+}
+
+// Check flags the anchor transactions unconfirmed for longer than
+// StuckAfter. With Auto set, stuck anchors are bumped, at most MaxAttempts
+// times each and no more often than every StuckAfter.
+func (b *Bumper) Check(now time.Time) error {
+	if err := b.refresh(now); err != nil {
+		return err
+	}
+
+	var due []string
+	b.mu.Lock()
+	if b.opts.Auto {
+		for txid, anchor := range b.anchors {
+			if !anchor.Stuck || anchor.Confirmed || autoBumps(anchor) >= b.opts.MaxAttempts {
+				continue
+			}
+			if last := lastAttempt(anchor); last != nil && now.Sub(last.BumpedAt) < b.opts.StuckAfter {
+				continue
+			}
+			due = append(due, txid)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, txid := range due {
+		if _, err := b.bump(txid, 0, true, now); err != nil {
+			log.Printf("Failed to fee bump anchor transaction %s: %v", txid, err)
+		}
+	}
+	return nil
+}
+
+// List returns the stuck and the bumped anchor transactions, oldest first.
+func (b *Bumper) List() []Anchor {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	list := []Anchor{}
+	for _, anchor := range b.anchors {
+		if anchor.Stuck || len(anchor.Bumps) > 0 {
+			list = append(list, anchor.clone())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].PendingSince.Before(list[j].PendingSince)
+	})
+	return list
+}
+
+// Anchor returns the state of the anchor transaction txid if it is stuck or
+// was bumped.
+func (b *Bumper) Anchor(txid string) (*Anchor, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	anchor, ok := b.anchors[txid]
+	if !ok || (!anchor.Stuck && len(anchor.Bumps) == 0) {
+		return nil, false
+	}
+	a := anchor.clone()
+	return &a, true
+}
+
+// Bump has LND fee bump the unconfirmed anchor transaction txid to feeRate
+// sat/vB, or to the estimated rate when feeRate is 0. It returns the anchor
+// with the bump recorded.
+func (b *Bumper) Bump(txid string, feeRate uint64) (*Anchor, error) {
+	now := time.Now()
+	if err := b.refresh(now); err != nil {
+		return nil, err
+	}
+	return b.bump(txid, feeRate, false, now)
+}
+
+func (b *Bumper) bump(txid string, feeRate uint64, auto bool, now time.Time) (*Anchor, error) {
+	b.mu.Lock()
+	anchor, ok := b.anchors[txid]
+	if !ok || anchor.Confirmed {
+		b.mu.Unlock()
+		return nil, ErrAnchorNotFound
+	}
+	var previous uint64
+	if last := anchor.LastBump(); last != nil {
+		previous = last.FeeRate
+	}
+	assetOutputs := anchor.assetOutputs
+	b.mu.Unlock()
+
+	rate, err := b.nextFeeRate(feeRate, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	// Failed attempts are recorded too, so automatic bumping backs off
+	bump := Bump{FeeRate: rate, Auto: auto, BumpedAt: now.UTC()}
+	var resp *lnd.BumpFeeResponse
+	outpoint, err := b.walletOutput(txid, assetOutputs)
+	if err == nil {
+		bump.Outpoint = fmt.Sprintf("%s:%d", outpoint.TxidStr, outpoint.OutputIndex)
+		resp, err = lnd.BumpFee(b.opts.LNDHost, b.opts.LNDMacaroon, outpoint, rate)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err != nil {
+		bump.Error = err.Error()
+	} else {
+		bump.Status = resp.Status
+		log.Printf("Fee bumped anchor transaction %s to %d sat/vB via %s", txid, rate, bump.Outpoint)
+	}
+	// The anchor may have confirmed while LND was bumping
+	if anchor, ok = b.anchors[txid]; !ok {
+		return nil, ErrAnchorNotFound
+	}
+	anchor.Bumps = append(anchor.Bumps, bump)
+	if err != nil {
+		return nil, err
+	}
+	a := anchor.clone()
+	return &a, nil
+}
+
+// nextFeeRate checks a requested fee rate against the previous bump and
+// MaxFeeRate. Without one, the estimate is used, raised by a quarter over
+// the previous bump if it would not replace it.
+func (b *Bumper) nextFeeRate(requested, previous uint64) (uint64, error) {
+	rate := requested
+	if rate == 0 {
+		estimate, err := b.opts.Estimate()
+		if err != nil {
+			return 0, err
+		}
+		rate = estimate
+		if rate <= previous {
+			rate = previous + previous/4 + 1
+		}
+		if b.opts.MaxFeeRate > 0 && rate > b.opts.MaxFeeRate {
+			rate = b.opts.MaxFeeRate
+		}
+	}
+
+	if b.opts.MaxFeeRate > 0 && rate > b.opts.MaxFeeRate {
+		return 0, fmt.Errorf("%w: %d sat/vB is above %d", ErrFeeRateTooHigh, rate, b.opts.MaxFeeRate)
+	}
+	if rate <= previous {
+		return 0, fmt.Errorf("%w: %d sat/vB is not above %d", ErrFeeRateTooLow, rate, previous)
+	}
+	return rate, nil
+}
+
+// walletOutput finds the largest output of txid that LND's wallet can
+// spend, normally the anchor transaction's BTC change. Anchor outputs in
+// assetOutputs are skipped: LND's wallet holds their keys too, and spending
+// one would burn the assets committed to it.
+func (b *Bumper) walletOutput(txid string, assetOutputs map[string]bool) (lnd.OutPoint, error) {
+	unspent, err := lnd.ListUnconfirmed(b.opts.LNDHost, b.opts.LNDMacaroon)
+	if err != nil {
+		return lnd.OutPoint{}, err
+	}
+
+	var (
+		found lnd.OutPoint
+		best  int64 = -1
+	)
+	for _, utxo := range unspent.Utxos {
+		if utxo.Outpoint.TxidStr != txid {
+			continue
+		}
+		if assetOutputs[fmt.Sprintf("%s:%d", utxo.Outpoint.TxidStr, utxo.Outpoint.OutputIndex)] {
+			continue
+		}
+		amount, _ := strconv.ParseInt(utxo.AmountSat, 10, 64)
+		if amount > best {
+			found, best = utxo.Outpoint, amount
+		}
+	}
+	if best < 0 {
+		return lnd.OutPoint{}, ErrNoWalletOutput
+	}
+	return found, nil
+}
+
+// refresh tracks the unconfirmed anchor transactions tapd reports and
+// flags those pending for longer than StuckAfter. Anchors that confirmed are
+// forgotten, unless they were bumped.
+func (b *Bumper) refresh(now time.Time) error {
+	transfers, err := b.tapdClient.GetTransfers(b.opts.TapdHost, b.opts.TapdMacaroon)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Batched sends share an anchor transaction, so its asset outputs are
+	// gathered across all of its transfers
+	unconfirmed := make(map[string]map[string]bool)
+	for _, transfer := range transfers.Transfers {
+		txid, err := anchorTxid(transfer)
+		if err != nil || transfer.AnchorTxBlockHash.Hash != "" {
+			continue
+		}
+		if unconfirmed[txid] == nil {
+			unconfirmed[txid] = make(map[string]bool)
+		}
+		for _, output := range transfer.Outputs {
+			unconfirmed[txid][output.Anchor.Outpoint] = true
+		}
+
+		anchor, ok := b.anchors[txid]
+		if !ok {
+			since, ok := transferTime(transfer.TransferTimestamp)
+			if !ok {
+				since = now
+			}
+			anchor = &Anchor{Txid: txid, PendingSince: since.UTC()}
+			b.anchors[txid] = anchor
+		}
+		if !anchor.Stuck && now.Sub(anchor.PendingSince) >= b.opts.StuckAfter {
+			log.Printf("Anchor transaction %s has been unconfirmed since %s", txid, anchor.PendingSince.Format(time.RFC3339))
+			anchor.Stuck = true
+		}
+	}
+
+	for txid, anchor := range b.anchors {
+		if assetOutputs, ok := unconfirmed[txid]; ok {
+			anchor.assetOutputs = assetOutputs
+			continue
+		}
+		if len(anchor.Bumps) == 0 {
+			delete(b.anchors, txid)
+			continue
+		}
+		anchor.Stuck = false
+		anchor.Confirmed = true
+	}
+	return nil
+}
+
+func (a *Anchor) clone() Anchor {
+	c := *a
+	c.Bumps = append([]Bump(nil), a.Bumps...)
+	return c
+}
+
+func autoBumps(anchor *Anchor) (count int) {
+	for _, bump := range anchor.Bumps {
+		if bump.Auto {
+			count++
+		}
+	}
+	return count
+}
+
+func lastAttempt(anchor *Anchor) *Bump {
+	if len(anchor.Bumps) == 0 {
+		return nil
+	}
+	return &anchor.Bumps[len(anchor.Bumps)-1]
+}
+
+// anchorTxid returns the txid of a transfer's anchor transaction, taken from
+// its outputs' outpoints like the transfers API does.
+func anchorTxid(transfer tapd.AssetTransferResponse) (string, error) {
+	if len(transfer.Outputs) == 0 {
+		return "", errNothingToAnchor
+	}
+	txid, _, _ := strings.Cut(transfer.Outputs[0].Anchor.Outpoint, ":")
+	return txid, nil
+}
+
+// transferTime parses tapd's transfer timestamp in unix seconds.
+func transferTime(timestamp string) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
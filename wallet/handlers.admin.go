@@ -0,0 +1,307 @@
+package wallet
+
+import (
+	"errors"
+	"net/http"
+	"tajfi-server/auth"
+	"tajfi-server/wallet/batch"
+	"tajfi-server/wallet/feebump"
+	"tajfi-server/wallet/operatorfee"
+	"tajfi-server/wallet/policy"
+	"tajfi-server/wallet/proofs"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type CreateAPIKeyPayload struct {
+	Label     string   `json:"label"`
+	PublicKey string   `json:"public_key" validate:"required"`
+	Scopes    []string `json:"scopes" validate:"required"`
+}
+
+// CreateAPIKey issues a scoped API key acting for a merchant public key. The
+// plaintext key is only ever returned by this call.
+func CreateAPIKey(apiKeys *auth.APIKeyStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var payload CreateAPIKeyPayload
+		if err := c.Bind(&payload); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+		if _, err := CompressPubKey(payload.PublicKey); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid public key: " + err.Error(),
+			})
+		}
+		if len(payload.Scopes) == 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "At least one scope is required",
+			})
+		}
+
+		key, plaintext, err := apiKeys.Create(payload.Label, payload.PublicKey, payload.Scopes)
+		if errors.Is(err, auth.ErrUnknownScope) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		// Never echo the stored hash back
+		view := *key
+		view.SecretHash = ""
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"api_key": plaintext,
+			"key":     view,
+		})
+	}
+}
+
+// ListAPIKeys lists every issued API key without secrets.
+func ListAPIKeys(apiKeys *auth.APIKeyStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"api_keys": apiKeys.List(),
+		})
+	}
+}
+
+// RevokeAPIKey disables an API key immediately.
+func RevokeAPIKey(apiKeys *auth.APIKeyStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := apiKeys.Revoke(c.Param("id"))
+		if errors.Is(err, auth.ErrAPIKeyInvalid) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": "API key not found",
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// GetOperatorFees reports the operator fees collected per asset, optionally
+// only those since the RFC 3339 time in the since query parameter.
+func GetOperatorFees(feeLedger *operatorfee.Ledger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var since time.Time
+		if value := c.QueryParam("since"); value != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "since must be an RFC 3339 time",
+				})
+			}
+		}
+
+		return c.JSON(http.StatusOK, feeLedger.Report(since))
+	}
+}
+
+// ListPolicies returns the default spending policy and every user's own.
+func ListPolicies(policies *policy.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, policies.List())
+	}
+}
+
+// GetPolicy returns the spending policy of the public_key path parameter,
+// or the default policy for "default".
+func GetPolicy(policies *policy.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		p, err := policies.Get(c.Param("public_key"))
+		if errors.Is(err, policy.ErrPolicyNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(http.StatusOK, p)
+	}
+}
+
+// PutPolicy sets the spending policy of a user, or the default policy,
+// replacing the previous one. A user's own policy takes the place of the
+// default entirely.
+func PutPolicy(policies *policy.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Param("public_key")
+		if key != policy.DefaultKey {
+			if _, err := CompressPubKey(key); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "Invalid public key: " + err.Error(),
+				})
+			}
+		}
+
+		var payload policy.Policy
+		if err := c.Bind(&payload); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+
+		p, err := policies.Put(key, payload)
+		if errors.Is(err, policy.ErrInvalidPolicy) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(http.StatusOK, p)
+	}
+}
+
+// DeletePolicy removes a user's spending policy, leaving them under the
+// default one, or removes the default policy.
+func DeletePolicy(policies *policy.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := policies.Delete(c.Param("public_key"))
+		if errors.Is(err, policy.ErrPolicyNotFound) {
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// ListStuckProofDeliveries lists the transfer outputs whose proofs tapd has
+// not delivered for too long.
+func ListStuckProofDeliveries(proofWatcher *proofs.Watcher) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"stuck": proofWatcher.Stuck(),
+		})
+	}
+}
+
+type RedeliverProofPayload struct {
+	Outpoint  string `json:"outpoint" validate:"required"`
+	ScriptKey string `json:"script_key" validate:"required"`
+}
+
+// RedeliverProof has tapd push the proof of a stuck transfer output to the
+// configured courier again.
+func RedeliverProof(proofWatcher *proofs.Watcher) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var payload RedeliverProofPayload
+		if err := c.Bind(&payload); err != nil || payload.Outpoint == "" || payload.ScriptKey == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+
+		delivery, err := proofWatcher.Redeliver(payload.Outpoint, payload.ScriptKey)
+		switch {
+		case errors.Is(err, proofs.ErrDeliveryNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, proofs.ErrNoCourier):
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+		case err != nil:
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(http.StatusOK, delivery)
+	}
+}
+
+// ListAnchorBatches lists the open anchor batch and the most recently
+// anchored ones. The list is empty when batching is disabled.
+func ListAnchorBatches(anchorBatcher *batch.Batcher) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		batches := []batch.Batch{}
+		if anchorBatcher != nil {
+			batches = append(batches, anchorBatcher.List()...)
+		}
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"batches": batches,
+		})
+	}
+}
+
+// ListFeeBumps lists the anchor transactions that have stayed unconfirmed
+// for too long, and those that were fee bumped.
+func ListFeeBumps(bumper *feebump.Bumper) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"anchors": bumper.List(),
+		})
+	}
+}
+
+type BumpFeePayload struct {
+	Txid string `json:"txid" validate:"required"`
+	// FeeRate of the CPFP child in sat/vB, estimated when 0
+	FeeRate uint64 `json:"fee_rate"`
+}
+
+// BumpFee has LND fee bump an unconfirmed anchor transaction with a child
+// spending its change.
+func BumpFee(bumper *feebump.Bumper) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var payload BumpFeePayload
+		if err := c.Bind(&payload); err != nil || payload.Txid == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+
+		anchor, err := bumper.Bump(payload.Txid, payload.FeeRate)
+		switch {
+		case errors.Is(err, feebump.ErrAnchorNotFound):
+			return c.JSON(http.StatusNotFound, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, feebump.ErrFeeRateTooLow), errors.Is(err, feebump.ErrFeeRateTooHigh):
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, feebump.ErrNoWalletOutput):
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+		case err != nil:
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(http.StatusOK, anchor)
+	}
+}
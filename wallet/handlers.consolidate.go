@@ -0,0 +1,73 @@
+package wallet
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"tajfi-server/config"
+	"tajfi-server/wallet/batch"
+	"tajfi-server/wallet/cosign"
+	"tajfi-server/wallet/scriptkeys"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ConsolidatePayload defines the request payload structure for /consolidate.
+type ConsolidatePayload struct {
+	AssetID string `json:"asset_id" validate:"required"`
+	FeeOptions
+}
+
+// Consolidate starts a self-send merging all of the caller's vUTXOs of one
+// asset into a single output at a fresh script key derived from theirs. It
+// returns the same signing session as /send/start and is finished through
+// /send/complete.
+func Consolidate(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, handoff *tapd.SigHandoff, anchorBatcher *batch.Batcher, cosigner *cosign.Cosigner, scriptKeys *scriptkeys.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var payload ConsolidatePayload
+		ctx := c.Request().Context()
+		pubKey := ctx.Value("public_key").(string)
+		if err := c.Bind(&payload); err != nil || payload.AssetID == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+
+		// Extract config from context
+		cfg := config.GetConfig(ctx)
+
+		utxos, err := tapdClient.GetUtxos(cfg.TapdHost, cfg.TapdMacaroon)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch balances from tapd: "+err.Error())
+		}
+
+		myUtxos := FilterOwnedUtxos(utxos, pubKey, AssetFilter{AssetID: payload.AssetID}, scriptKeys)
+		log.Printf("Consolidating %d UTXOs for pubkey %s", len(myUtxos.Inputs), pubKey)
+
+		params := ReceiveParams{
+			PubKey:       pubKey,
+			AssetID:      payload.AssetID,
+			LNDHost:      cfg.LNDHost,
+			LNMacaroon:   cfg.LNDMacaroon,
+			TapdHost:     cfg.TapdHost,
+			TapdMacaroon: cfg.TapdMacaroon,
+			Cosigner:     cosigner,
+		}
+
+		recipient, err := ConsolidationRecipient(params, tapdClient, scriptKeys, myUtxos.Inputs)
+		if errors.Is(err, ErrNothingToConsolidate) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		return startSendSession(c, tapdClient, sendSessions, handoff, anchorBatcher, cosigner, scriptKeys, pubKey, []sessions.Recipient{recipient}, myUtxos.Inputs, payload.FeeOptions)
+	}
+}
@@ -0,0 +1,123 @@
+package wallet
+
+import (
+	"errors"
+	"net/http"
+	"tajfi-server/wallet/contacts"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ContactPayload defines the request payload structure for creating and
+// updating contacts.
+type ContactPayload struct {
+	Label       string `json:"label" validate:"required"`
+	Npub        string `json:"npub"`
+	ScriptKey   string `json:"script_key"`
+	InternalKey string `json:"internal_key"`
+}
+
+func (p ContactPayload) contact() contacts.Contact {
+	return contacts.Contact{
+		Label:       p.Label,
+		Npub:        p.Npub,
+		ScriptKey:   p.ScriptKey,
+		InternalKey: p.InternalKey,
+	}
+}
+
+// ListContacts returns the caller's saved contacts.
+func ListContacts(contactBook *contacts.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pubKey := c.Request().Context().Value("public_key").(string)
+
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"contacts": contactBook.List(pubKey),
+		})
+	}
+}
+
+// GetContact returns one of the caller's contacts.
+func GetContact(contactBook *contacts.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pubKey := c.Request().Context().Value("public_key").(string)
+
+		contact, err := contactBook.Get(pubKey, c.Param("id"))
+		if err != nil {
+			return contactError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, contact)
+	}
+}
+
+// CreateContact saves a contact for the caller.
+func CreateContact(contactBook *contacts.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pubKey := c.Request().Context().Value("public_key").(string)
+
+		var payload ContactPayload
+		if err := c.Bind(&payload); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+
+		contact, err := contactBook.Create(pubKey, payload.contact())
+		if err != nil {
+			return contactError(c, err)
+		}
+
+		return c.JSON(http.StatusCreated, contact)
+	}
+}
+
+// UpdateContact replaces the label and destination of one of the caller's
+// contacts.
+func UpdateContact(contactBook *contacts.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pubKey := c.Request().Context().Value("public_key").(string)
+
+		var payload ContactPayload
+		if err := c.Bind(&payload); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+
+		contact, err := contactBook.Update(pubKey, c.Param("id"), payload.contact())
+		if err != nil {
+			return contactError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, contact)
+	}
+}
+
+// DeleteContact removes one of the caller's contacts.
+func DeleteContact(contactBook *contacts.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pubKey := c.Request().Context().Value("public_key").(string)
+
+		if err := contactBook.Delete(pubKey, c.Param("id")); err != nil {
+			return contactError(c, err)
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// contactError maps contact store errors to HTTP responses.
+func contactError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, contacts.ErrContactNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, contacts.ErrInvalidContact), errors.Is(err, contacts.ErrTooManyContacts):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
@@ -0,0 +1,178 @@
+package wallet
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"tajfi-server/config"
+	"tajfi-server/wallet/cosign"
+	"tajfi-server/wallet/lnd"
+	"tajfi-server/wallet/operatorfee"
+	"tajfi-server/wallet/policy"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CosignNonce is the user's MuSig2 public nonce for one anchor input.
+type CosignNonce struct {
+	InputIndex  int    `json:"input_index"`
+	PublicNonce string `json:"public_nonce"`
+}
+
+type CosignNoncesPayload struct {
+	Nonces []CosignNonce `json:"nonces"`
+}
+
+// CosignPartialSig is the user's MuSig2 partial signature of one anchor
+// input.
+type CosignPartialSig struct {
+	InputIndex       int    `json:"input_index"`
+	PartialSignature string `json:"partial_signature"`
+}
+
+type CosignPartialSigsPayload struct {
+	PartialSignatures []CosignPartialSig `json:"partial_signatures"`
+}
+
+// RegisterCosignNonces records the user's public nonces for the anchor
+// inputs of a send awaiting its cosignature, after which the user can sign.
+func RegisterCosignNonces(sendSessions *sessions.Store, cosigner *cosign.Cosigner) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var payload CosignNoncesPayload
+		if err := c.Bind(&payload); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+		pubKey := c.Request().Context().Value("public_key").(string)
+
+		session, err := sendSessions.ClaimCosign(c.Param("id"), pubKey)
+		if err != nil {
+			return sessionError(c, err)
+		}
+
+		nonces := make(map[int]string, len(payload.Nonces))
+		for _, nonce := range payload.Nonces {
+			nonces[nonce.InputIndex] = nonce.PublicNonce
+		}
+
+		inputs, err := cosigner.RegisterNonces(session.Cosign.Inputs, nonces)
+		switch {
+		case errors.Is(err, cosign.ErrInvalidNonce):
+			sendSessions.Unclaim(session.ID)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+				"code":  "invalid_nonce",
+			})
+		case errors.Is(err, cosign.ErrNoncesAlreadyExist):
+			sendSessions.Unclaim(session.ID)
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+		case err != nil:
+			// The signer may hold some of the nonces already
+			sendSessions.Fail(session.ID, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		updated, err := sendSessions.Update(session.ID, func(s *sessions.Session) {
+			s.Cosign.Inputs = inputs
+		})
+		sendSessions.Unclaim(session.ID)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		return c.JSON(http.StatusOK, updated)
+	}
+}
+
+// CompleteCosign takes the user's partial signatures of the anchor inputs
+// of a send awaiting its cosignature, adds the server's, has LND sign its
+// own inputs and tapd publish the anchor transaction. It returns the
+// resulting transfer like /send/complete.
+func CompleteCosign(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, cosigner *cosign.Cosigner, feeLedger *operatorfee.Ledger, policies *policy.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var payload CosignPartialSigsPayload
+		if err := c.Bind(&payload); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+		ctx := c.Request().Context()
+		cfg := config.GetConfig(ctx)
+		pubKey := ctx.Value("public_key").(string)
+
+		session, err := sendSessions.ClaimCosign(c.Param("id"), pubKey)
+		if err != nil {
+			return sessionError(c, err)
+		}
+
+		partialSigs := make(map[int]string, len(payload.PartialSignatures))
+		for _, sig := range payload.PartialSignatures {
+			partialSigs[sig.InputIndex] = sig.PartialSignature
+		}
+
+		// Partial signatures are checked before the server signs, so bad
+		// ones leave the session open for another try
+		signedAnchor, err := cosigner.Finish(pubKey, session.Cosign, partialSigs)
+		switch {
+		case errors.Is(err, cosign.ErrInvalidPartialSig):
+			sendSessions.Unclaim(session.ID)
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+				"code":  "invalid_partial_signature",
+			})
+		case errors.Is(err, cosign.ErrNoncesMissing):
+			sendSessions.Unclaim(session.ID)
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+		case err != nil:
+			sendSessions.Fail(session.ID, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		// LND signs the inputs funding the fee and finalizes the transaction
+		finalized, err := lnd.FinalizePsbt(cfg.LNDHost, cfg.LNDMacaroon, signedAnchor)
+		if err != nil {
+			sendSessions.Fail(session.ID, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		transfer, err := tapdClient.PublishAndLogTransfer(tapd.PublishAndLogTransferParams{
+			AnchorPSBT: finalized.SignedPsbt,
+			Committed:  *session.Cosign.Committed,
+			TapdHost:   cfg.TapdHost,
+			Macaroon:   cfg.TapdMacaroon,
+		})
+		if err != nil {
+			sendSessions.Fail(session.ID, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		if _, err := sendSessions.Transition(session.ID, sessions.StatusAnchored, func(s *sessions.Session) {
+			s.Transfer = transfer
+			s.AnchorTxHash = transfer.AnchorTxHash
+			s.Cosign.AnchorPSBT = finalized.SignedPsbt
+		}); err != nil {
+			log.Printf("Failed to mark send session %s as anchored: %v", session.ID, err)
+		}
+		recordOperatorFees(feeLedger, session, transfer.AnchorTxHash)
+		recordSpends(policies, session)
+
+		return c.JSON(http.StatusOK, transfer)
+	}
+}
@@ -1,60 +1,171 @@
 package wallet
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"tajfi-server/auth"
 	"tajfi-server/config"
+	"tajfi-server/wallet/feebump"
+	"tajfi-server/wallet/policy"
+	"tajfi-server/wallet/proofs"
+	"tajfi-server/wallet/scriptkeys"
 	"tajfi-server/wallet/tapd"
 	"time"
 
-	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 )
 
 type ConnectRequest struct {
 	PublicKey string `json:"public_key" validate:"required"`
+	Challenge string `json:"challenge" validate:"required"`
 	Signature string `json:"signature" validate:"required"`
 }
 
-// ConnectWallet handles wallet connection by validating the public key and signature.
-func ConnectWallet(c echo.Context) error {
-	// Extract the config from context
-	cfg := config.GetConfig(c.Request().Context())
+// GetChallenge issues a single-use login challenge for the public_key query
+// parameter. The client signs SHA-256(challenge) with BIP-340 and posts it
+// to /wallet/connect.
+func GetChallenge(challenges *auth.ChallengeStore) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pubKey := c.QueryParam("public_key")
+		if _, err := CompressPubKey(pubKey); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid public key: " + err.Error(),
+			})
+		}
+
+		challenge, err := challenges.Issue(pubKey)
+		if errors.Is(err, auth.ErrTooManyChallenges) {
+			return c.JSON(http.StatusTooManyRequests, map[string]string{
+				"error": err.Error(),
+				"code":  "too_many_challenges",
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to issue challenge",
+			})
+		}
+
+		return c.JSON(http.StatusOK, challenge)
+	}
+}
+
+// ConnectWallet handles wallet connection by verifying a BIP-340 signature
+// over a challenge previously issued by GetChallenge. The first connection of
+// a public key starts its new account cooldown.
+func ConnectWallet(challenges *auth.ChallengeStore, tokens *auth.TokenService, policies *policy.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(ConnectRequest)
+		if err := c.Bind(req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+
+		if err := auth.VerifyMessage(req.PublicKey, req.Challenge, req.Signature); err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{
+				"error": "Invalid signature",
+				"code":  "invalid_signature",
+			})
+		}
+
+		if err := challenges.Redeem(req.Challenge, req.PublicKey); err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{
+				"error": err.Error(),
+				"code":  challengeErrorCode(err),
+			})
+		}
+
+		pair, err := tokens.Issue(req.PublicKey)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": "Failed to generate token",
+			})
+		}
+
+		if err := policies.Seen(req.PublicKey, time.Now()); err != nil {
+			log.Printf("Failed to record first connection of %s: %v", req.PublicKey, err)
+		}
 
-	req := new(ConnectRequest)
-	if err := c.Bind(req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Invalid request payload",
-		})
+		return c.JSON(http.StatusOK, pair)
 	}
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// RefreshToken rotates a refresh token into a new access/refresh token pair.
+func RefreshToken(tokens *auth.TokenService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := new(RefreshRequest)
+		if err := c.Bind(req); err != nil || req.RefreshToken == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
 
-	if !isValidSignature(req.PublicKey, req.Signature) {
-		return c.JSON(http.StatusUnauthorized, map[string]string{
-			"error": "Invalid signature",
-		})
+		pair, err := tokens.Refresh(req.RefreshToken)
+		if errors.Is(err, auth.ErrRefreshTokenReused) {
+			return c.JSON(http.StatusUnauthorized, map[string]string{
+				"error": err.Error(),
+				"code":  "refresh_token_reused",
+			})
+		}
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{
+				"error": err.Error(),
+				"code":  "refresh_token_invalid",
+			})
+		}
+
+		return c.JSON(http.StatusOK, pair)
 	}
+}
 
-	claims := jwt.MapClaims{
-		"public_key": req.PublicKey,
-		"exp":        time.Now().Add(time.Hour * 24).Unix(),
+// Logout revokes the caller's access token along with every other token
+// issued from the same login. Only bearer tokens can be logged out: NIP-98
+// events are single use and API keys are revoked by the operator.
+func Logout(tokens *auth.TokenService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		family, _ := c.Request().Context().Value("token_family").(string)
+		if family == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Only sessions authenticated with a bearer token can be logged out",
+				"code":  "not_a_token_session",
+			})
+		}
+		tokens.RevokeFamily(family)
+
+		return c.NoContent(http.StatusNoContent)
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(cfg.JWTSecret))
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to generate token",
-		})
+// GetJWKS serves the public keys access tokens are signed with.
+func GetJWKS(keys *auth.KeySet) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, keys.JWKS())
 	}
+}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"token": signedToken,
-	})
+// challengeErrorCode maps challenge redemption errors to stable API codes.
+func challengeErrorCode(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrChallengeExpired):
+		return "challenge_expired"
+	case errors.Is(err, auth.ErrChallengeReplayed):
+		return "challenge_replayed"
+	case errors.Is(err, auth.ErrChallengeForeign):
+		return "challenge_foreign"
+	default:
+		return "challenge_not_found"
+	}
 }
 
-func GetBalances(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
+func GetBalances(tapdClient tapd.TapdClientInterface, scriptKeys *scriptkeys.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		var (
 			ctx    = c.Request().Context()
@@ -67,7 +178,7 @@ func GetBalances(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch balances from tapd: "+err.Error())
 		}
 
-		balances, err := constructWalletBalancesResponse(utxos, pubKey)
+		balances, err := constructWalletBalancesResponse(utxos, pubKey, scriptKeys)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to construct wallet balances: "+err.Error())
 		}
@@ -77,19 +188,20 @@ func GetBalances(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch transfers from tapd: "+err.Error())
 		}
-		transfers := GetTransfersResponse(tapdTransfers, pubKey)
+		transfers := GetTransfersResponse(tapdTransfers, pubKey, scriptKeys)
 
 		// Step 4: Update balances with unconfirmed transfers
 		UpdateBalancesWithUnconfirmed(balances, transfers)
+		AggregateGroupBalances(balances)
 
 		return c.JSON(http.StatusOK, balances)
 	}
 }
 
 // ConstructWalletBalancesResponse constructs a WalletBalancesResponse by finding
-// every Asset with a ScriptKey matching the provided value, summing up their amounts,
+// every Asset with a ScriptKey owned by pubKey, summing up their amounts,
 // and grouping them by AssetGenesis.
-func constructWalletBalancesResponse(utxos *tapd.GetUtxosResponse, scriptKey string) (*tapd.WalletBalancesResponse, error) {
+func constructWalletBalancesResponse(utxos *tapd.GetUtxosResponse, pubKey string, scriptKeys *scriptkeys.Store) (*tapd.WalletBalancesResponse, error) {
 	assetBalances := make(map[string]tapd.AssetBalance)
 
 	for _, utxo := range utxos.ManagedUtxos {
@@ -97,7 +209,7 @@ func constructWalletBalancesResponse(utxos *tapd.GetUtxosResponse, scriptKey str
 			genesisID := asset.AssetGenesis.AssetID
 			amount := 0
 
-			if asset.ScriptKey == ("02" + scriptKey) {
+			if scriptKeys.Owns(pubKey, asset.ScriptKey) {
 
 				log.Println(asset)
 				var err error
@@ -117,6 +229,7 @@ func constructWalletBalancesResponse(utxos *tapd.GetUtxosResponse, scriptKey str
 			} else {
 				assetBalances[genesisID] = tapd.AssetBalance{
 					AssetGenesis: asset.AssetGenesis,
+					GroupKey:     asset.GroupKey(),
 					Balance:      strconv.Itoa(amount),
 				}
 			}
@@ -126,7 +239,9 @@ func constructWalletBalancesResponse(utxos *tapd.GetUtxosResponse, scriptKey str
 	return &tapd.WalletBalancesResponse{AssetBalances: assetBalances}, nil
 }
 
-func GetTransfers(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
+// GetTransfers lists the caller's transfers with the delivery state of
+// their outputs' proofs.
+func GetTransfers(tapdClient tapd.TapdClientInterface, proofWatcher *proofs.Watcher, bumper *feebump.Bumper, scriptKeys *scriptkeys.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		var (
 			ctx    = c.Request().Context()
@@ -139,7 +254,11 @@ func GetTransfers(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch balances from tapd: "+err.Error())
 		}
 
-		return c.JSON(http.StatusOK, GetTransfersResponse(tapdTransfers, pubKey))
+		transfers := GetTransfersResponse(tapdTransfers, pubKey, scriptKeys)
+		markStuckDeliveries(transfers, proofWatcher)
+		markFeeBumps(transfers, bumper)
+
+		return c.JSON(http.StatusOK, transfers)
 	}
 }
 
@@ -147,9 +266,3 @@ func GetWallet(c echo.Context) error {
 	wallet := Wallet{Address: GenerateNewAddress(), Balance: GetBalance()}
 	return c.JSON(http.StatusOK, wallet)
 }
-
-// isValidSignature simulates signature verification (stub for demonstration).
-func isValidSignature(publicKey, signature string) bool {
-	// Replace with proper cryptographic signature validation logic
-	return signature != "valid_signaturexyz"
-}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"tajfi-server/config"
+	"tajfi-server/wallet/cosign"
 	"tajfi-server/wallet/tapd"
 
 	"github.com/labstack/echo/v4"
@@ -27,7 +28,7 @@ type RequestPayload struct {
 }
 
 // StartSendAsset initiates a send transaction by calling the service.
-func ReceiveAsset(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
+func ReceiveAsset(tapdClient tapd.TapdClientInterface, cosigner *cosign.Cosigner) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		ctx := c.Request().Context()
 		pubKey := ctx.Value("public_key").(string)
@@ -59,6 +60,7 @@ func ReceiveAsset(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
 			LNMacaroon:   cfg.LNDMacaroon,
 			TapdHost:     cfg.TapdHost,
 			TapdMacaroon: cfg.TapdMacaroon,
+			Cosigner:     cosigner,
 		}
 
 		response, err := Receive(params, tapdClient)
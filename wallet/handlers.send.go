@@ -1,10 +1,19 @@
 package wallet
 
 import (
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"os"
 	"tajfi-server/config"
+	"tajfi-server/wallet/batch"
+	"tajfi-server/wallet/contacts"
+	"tajfi-server/wallet/cosign"
+	"tajfi-server/wallet/idempotency"
+	"tajfi-server/wallet/operatorfee"
+	"tajfi-server/wallet/policy"
+	"tajfi-server/wallet/scriptkeys"
+	"tajfi-server/wallet/sessions"
 	"tajfi-server/wallet/tapd"
 
 	"github.com/labstack/echo/v4"
@@ -43,11 +52,25 @@ func DecodeAddress(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
 
 // SendStartPayload defines the request payload structure for /send/start.
 type SendStartPayload struct {
-	Invoice string `json:"invoice" validate:"required"`
+	Invoice string `json:"invoice"`
+	// Invoices pays several tap addresses of the same asset in one vPSBT
+	Invoices []string `json:"invoices"`
+	// ContactID pays a saved contact instead, at a fresh address minted
+	// for AssetID and Amount
+	ContactID string `json:"contact_id"`
+	AssetID   string `json:"asset_id"`
+	Amount    uint64 `json:"amount"`
+	// CoinSelection overrides the configured coin selection strategy
+	CoinSelection string `json:"coin_selection"`
+	// DryRun returns the plan for the send without opening a session
+	DryRun bool `json:"dry_run"`
+	FeeOptions
 }
 
-// SendStart initiates the send transaction by calling Tapd and returning a vPSBT
-func SendStart(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
+// SendStart funds a vPSBT paying every invoice, or a saved contact, and
+// opens a signing session holding it together with the sighashes the user
+// has to sign.
+func SendStart(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, handoff *tapd.SigHandoff, anchorBatcher *batch.Batcher, cosigner *cosign.Cosigner, feeSchedule *operatorfee.Schedule, policies *policy.Store, contactBook *contacts.Store, scriptKeys *scriptkeys.Store) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		// Parse the request payload
 		var payload SendStartPayload
@@ -64,56 +87,338 @@ func SendStart(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
 				})
 			}*/
 
+		invoices := payload.Invoices
+		if payload.Invoice != "" {
+			invoices = append([]string{payload.Invoice}, invoices...)
+		}
+
 		// Extract config from context
 		cfg := config.GetConfig(c.Request().Context())
 
+		strategy := payload.CoinSelection
+		if strategy == "" {
+			strategy = cfg.CoinSelectionStrategy
+		}
+		selector, err := NewCoinSelector(strategy)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
 		utxos, err := tapdClient.GetUtxos(cfg.TapdHost, cfg.TapdMacaroon)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch balances from tapd: "+err.Error())
 		}
 
-		// Decode the address
-		decoded, err := tapdClient.DecodeAddr(cfg.TapdHost, cfg.TapdMacaroon, payload.Invoice)
-		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to decode address")
+		var (
+			recipients  []sessions.Recipient
+			assetFilter AssetFilter
+		)
+		if payload.ContactID != "" {
+			if len(invoices) > 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": ErrContactWithInvoices.Error(),
+				})
+			}
+
+			// The contact is paid in the asset's group, if it has one, like
+			// an invoice would carry it
+			params := ReceiveParams{
+				AssetID:      payload.AssetID,
+				GroupKey:     AssetFilterFor(utxos, payload.AssetID).GroupKey,
+				LNDHost:      cfg.LNDHost,
+				LNMacaroon:   cfg.LNDMacaroon,
+				TapdHost:     cfg.TapdHost,
+				TapdMacaroon: cfg.TapdMacaroon,
+				Cosigner:     cosigner,
+				DryRun:       payload.DryRun,
+			}
+			recipients, assetFilter, err = ContactRecipients(params, tapdClient, contactBook, pubKey, payload.ContactID, payload.Amount)
+			switch {
+			case errors.Is(err, contacts.ErrContactNotFound):
+				return c.JSON(http.StatusNotFound, map[string]string{
+					"error": err.Error(),
+				})
+			case errors.Is(err, ErrContactNeedsAmount):
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": err.Error(),
+				})
+			case err != nil:
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": err.Error(),
+				})
+			}
+		} else {
+			// Decode and validate every address
+			recipients, assetFilter, err = DecodeRecipients(tapdClient, cfg.TapdHost, cfg.TapdMacaroon, invoices)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": err.Error(),
+				})
+			}
+		}
+
+		// The operator's fee is paid to an extra output of the same vPSBT,
+		// only planned for a dry run
+		if fee := feeSchedule.FeeFor(assetFilter.AssetID, assetFilter.GroupKey, TotalAmount(recipients)); fee > 0 {
+			feeRecipient := OperatorFeePlaceholder(assetFilter.AssetID, fee)
+			if !payload.DryRun {
+				feeRecipient, err = OperatorFeeRecipient(tapdClient, cfg.TapdHost, cfg.TapdMacaroon, assetFilter.AssetID, fee)
+				if err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{
+						"error": err.Error(),
+					})
+				}
+			}
+			recipients = append(recipients, feeRecipient)
+		}
+
+		if err := CheckPolicy(policies, sendSessions, pubKey, recipients); err != nil {
+			return policyError(c, err)
 		}
 
-		myUtxos := FilterOwnedUtxos(utxos, pubKey, decoded.AssetID)
+		myUtxos := FilterOwnedUtxos(utxos, pubKey, assetFilter, scriptKeys)
 		log.Printf("Found %d UTXOs for pubkey %s", len(myUtxos.Inputs), pubKey)
-		// Call the Tapd service to fund the PSBT
-		fundedPsbt, err := tapdClient.FundVirtualPSBT(cfg.TapdHost, cfg.TapdMacaroon, payload.Invoice, tapd.PrevIds{myUtxos.Inputs})
+
+		if payload.DryRun {
+			plan, err := PlanSend(tapdClient, cfg, assetFilter, recipients, myUtxos.Inputs, selector, payload.FeeOptions)
+			switch {
+			case errors.Is(err, ErrConflictingFeeOptions), errors.Is(err, ErrFeeRateOutOfBounds):
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": err.Error(),
+				})
+			case err != nil:
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": err.Error(),
+				})
+			}
+			return c.JSON(http.StatusOK, plan)
+		}
+
+		// Only hand tapd the inputs needed to cover the send
+		inputs, err := selector.Select(myUtxos.Inputs, TotalAmount(recipients))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+
+		return startSendSession(c, tapdClient, sendSessions, handoff, anchorBatcher, cosigner, scriptKeys, pubKey, recipients, inputs, payload.FeeOptions)
+	}
+}
+
+// startSendSession funds a vPSBT paying recipients from inputs, opens a
+// signing session for it and responds with the sighashes to sign. The
+// session is completed through /send/complete. With batching on, the send's
+// anchor outputs are reserved in the open batch before funding so they do
+// not overlap those of the other sends anchored with it.
+func startSendSession(c echo.Context, tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, handoff *tapd.SigHandoff, anchorBatcher *batch.Batcher, cosigner *cosign.Cosigner, scriptKeys *scriptkeys.Store, pubKey string, recipients []sessions.Recipient, inputs []tapd.PrevId, feeOpts FeeOptions) error {
+	cfg := config.GetConfig(c.Request().Context())
+
+	// Price the anchor transaction before leasing anything. Without explicit
+	// fee options a failed estimate just leaves the fee rate to tapd.
+	feeEstimate, err := EstimateAnchorFee(cfg, feeOpts, inputs, len(recipients))
+	switch {
+	case errors.Is(err, ErrConflictingFeeOptions), errors.Is(err, ErrFeeRateOutOfBounds):
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	case err != nil && feeOpts != (FeeOptions{}):
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	case err != nil:
+		log.Printf("Sending without a fee estimate: %v", err)
+	}
+
+	// Sends spending MuSig2 anchors are anchored on their own once cosigned
+	batched := anchorBatcher != nil
+	if batched && cosigner != nil {
+		cosigned, err := spendsCosignedAnchor(tapdClient, cfg, cosigner, inputs)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		batched = !cosigned
+	}
+
+	// Each recipient gets an anchor output, followed by tapd's change
+	var slot batch.Slot
+	if batched {
+		slot, err = anchorBatcher.Reserve(len(recipients) + 1)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": err.Error(),
 			})
 		}
+	}
+
+	// Call the Tapd service to fund one PSBT paying every recipient
+	fundedPsbt, err := tapdClient.FundVirtualPSBT(cfg.TapdHost, cfg.TapdMacaroon, recipientAddresses(recipients), tapd.PrevIds{Inputs: inputs}, slot.FirstOutput)
+	if err != nil {
+		if batched {
+			anchorBatcher.Release(slot)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	session, err := sendSessions.Create(pubKey, fundedPsbt.FundedPSBT, recipients, inputs)
+	if err != nil {
+		if batched {
+			anchorBatcher.Release(slot)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	if batched {
+		anchorBatcher.Assign(slot, session.ID)
+	}
+
+	// Have the modified tapd write out the sighashes for this vPSBT
+	var sighashes []sessions.InputSighash
+	rawSighashes, err := handoff.Sighashes(tapdClient, cfg.TapdHost, cfg.TapdMacaroon, fundedPsbt.FundedPSBT)
+	if err == nil {
+		sighashes, err = tagSighashes(rawSighashes, inputs, scriptKeys)
+	}
+	if err != nil {
+		sendSessions.Fail(session.ID, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	// Single-input clients keep using the flat field
+	if len(sighashes) == 1 {
+		fundedPsbt.SighashHexToSign = sighashes[0].SighashHex
+	}
+
+	session, err = sendSessions.Transition(session.ID, sessions.StatusAwaitingSignature, func(s *sessions.Session) {
+		s.Sighashes = sighashes
+		if batched {
+			s.BatchID = slot.BatchID
+		}
+		if feeEstimate != nil {
+			s.FeeRate = feeEstimate.FeeRate
+		}
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
 
-		// Call the modified Tapd service to write our sighash.hex file
-		_, err = tapdClient.SignVirtualPSBT(cfg.TapdHost, cfg.TapdMacaroon, fundedPsbt.FundedPSBT)
-		// if err != nil { we dont really care if this fails, it is expected }
+	return c.JSON(http.StatusOK, SendStartResponse{
+		FundVirtualPSBTResponse: fundedPsbt,
+		SessionID:               session.ID,
+		ExpiresAt:               session.ExpiresAt,
+		Sighashes:               session.Sighashes,
+		FeeEstimate:             feeEstimate,
+		OperatorFee:             OperatorFee(recipients),
+	})
+}
+
+// GetSendSession returns the state of one of the caller's send sessions.
+func GetSendSession(sendSessions *sessions.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pubKey := c.Request().Context().Value("public_key").(string)
 
-		// Fetch the hex file now
-		taprootSigsDir := cfg.TaprootSigsDir
-		sighash, err := ReadFile(taprootSigsDir + "sighash.hex")
+		session, err := sendSessions.Get(c.Param("id"), pubKey)
+		if err != nil {
+			return sessionError(c, err)
+		}
+
+		return c.JSON(http.StatusOK, session)
+	}
+}
+
+// CancelSend cancels one of the caller's sends that has not been signed yet,
+// releasing the inputs tapd leased for it.
+func CancelSend(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, cosigner *cosign.Cosigner) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		cfg := config.GetConfig(ctx)
+		pubKey := ctx.Value("public_key").(string)
+
+		session, err := sendSessions.ClaimCancel(c.Param("id"), pubKey)
+		if err != nil {
+			return sessionError(c, err)
+		}
+
+		session, err = cancelSession(tapdClient, sendSessions, cosigner, cfg, session, "user")
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": err.Error(),
 			})
 		}
-		fundedPsbt.SighashHexToSign = sighash
 
-		return c.JSON(http.StatusOK, fundedPsbt)
+		return c.JSON(http.StatusOK, session)
+	}
+}
+
+// CancelExpiredSend returns the session store's OnExpire hook, which cancels
+// expired sends so their inputs are not left leased.
+func CancelExpiredSend(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, cosigner *cosign.Cosigner, cfg *config.Config) func(*sessions.Session) {
+	return func(session *sessions.Session) {
+		if _, err := cancelSession(tapdClient, sendSessions, cosigner, cfg, session, "expiry"); err != nil {
+			log.Printf("Failed to cancel expired send session %s: %v", session.ID, err)
+		}
+	}
+}
+
+// ReleaseFailedSend returns the session store's OnFail hook, which releases
+// tapd's leases on the inputs of failed sends and gives up the anchor
+// transaction of those awaiting their cosignature. Failures are logged,
+// leases expire on their own.
+func ReleaseFailedSend(tapdClient tapd.TapdClientInterface, cosigner *cosign.Cosigner, cfg *config.Config) func(*sessions.Session) {
+	return func(session *sessions.Session) {
+		if err := ReleaseInputs(tapdClient, cfg.TapdHost, cfg.TapdMacaroon, session.Inputs); err != nil {
+			log.Printf("Failed to release leases of failed send session %s: %v", session.ID, err)
+		}
+		abandonCosign(cosigner, cfg, session.Cosign)
 	}
 }
 
+// cancelSession releases tapd's leases on the inputs of a claimed session
+// and marks it cancelled. tapd leases whole anchor outpoints, so this frees
+// both the assets and the BTC outputs carrying them. A session awaiting its
+// cosignature also gives up its anchor transaction. If releasing fails the
+// claim is dropped and the session keeps its state.
+func cancelSession(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, cosigner *cosign.Cosigner, cfg *config.Config, session *sessions.Session, by string) (*sessions.Session, error) {
+	if err := ReleaseInputs(tapdClient, cfg.TapdHost, cfg.TapdMacaroon, session.Inputs); err != nil {
+		sendSessions.Unclaim(session.ID)
+		return nil, err
+	}
+
+	cancelled, err := sendSessions.Transition(session.ID, sessions.StatusCancelled, func(s *sessions.Session) {
+		s.CancelledBy = by
+	})
+	if err != nil {
+		return nil, err
+	}
+	abandonCosign(cosigner, cfg, session.Cosign)
+	return cancelled, nil
+}
+
 // SendCompletePayload defines the request payload structure for /send/complete.
 type SendCompletePayload struct {
-	PSBT         string `json:"psbt" validate:"required"`
-	SignatureHex string `json:"signature_hex" validate:"required"`
+	SessionID  string           `json:"session_id" validate:"required"`
+	Signatures []InputSignature `json:"signatures"`
+	// SignatureHex is accepted in place of Signatures for single-input sends
+	SignatureHex string `json:"signature_hex"`
 }
 
-// SendComplete completes the send transaction by calling Tapd and returning the transaction ID
-func SendComplete(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
+// SendComplete signs the session's vPSBT with the user's signature and
+// anchors it, returning the resulting transfer. With batching enabled the
+// signed vPSBT is queued instead and the queued session is returned with
+// 202 Accepted; the session reports its anchor transaction once the batch
+// is anchored. Sends spending MuSig2 anchor outputs are never batched: the
+// session is returned with 202 Accepted awaiting the user's cosignature of
+// the anchor transaction.
+func SendComplete(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, handoff *tapd.SigHandoff, completions *idempotency.Store, feeLedger *operatorfee.Ledger, policies *policy.Store, anchorBatcher *batch.Batcher, cosigner *cosign.Cosigner) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		// Parse the request payload
 		var payload SendCompletePayload
@@ -128,18 +433,72 @@ func SendComplete(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
 				})
 			}*/
 		// Extract config from context
-		cfg := config.GetConfig(c.Request().Context())
+		ctx := c.Request().Context()
+		cfg := config.GetConfig(ctx)
+		pubKey := ctx.Value("public_key").(string)
 
-		// Write the override signature to the file that tapd recognizes
-		if err := WriteSignatureToFile(cfg.TaprootSigsDir+"signature.hex", payload.SignatureHex); err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
+		// Retries carrying the same Idempotency-Key get the first successful
+		// response back instead of signing and anchoring again
+		var done bool
+		idempotencyKey := c.Request().Header.Get("Idempotency-Key")
+		if idempotencyKey != "" {
+			if len(idempotencyKey) > idempotency.MaxKeyLength {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "Idempotency-Key is too long",
+				})
+			}
+
+			result, err := completions.Begin(pubKey, idempotencyKey, payload.SessionID)
+			switch {
+			case errors.Is(err, idempotency.ErrInProgress):
+				return c.JSON(http.StatusConflict, map[string]string{
+					"error": err.Error(),
+				})
+			case errors.Is(err, idempotency.ErrKeyReused):
+				return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+					"error": err.Error(),
+				})
+			case result != nil:
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.JSONBlob(result.Status, result.Body)
+			}
+
+			defer func() {
+				if !done {
+					completions.Abandon(pubKey, idempotencyKey)
+				}
+			}()
+		}
+
+		session, err := sendSessions.Get(payload.SessionID, pubKey)
+		if err != nil {
+			return sessionError(c, err)
+		}
+
+		signatures := payload.Signatures
+		if len(signatures) == 0 && payload.SignatureHex != "" {
+			signatures = []InputSignature{{InputIndex: 0, SignatureHex: payload.SignatureHex}}
+		}
+
+		// Reject bad signatures here instead of letting tapd fail on them
+		orderedSignatures, err := verifyInputSignatures(session.Sighashes, pubKey, signatures)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
 				"error": err.Error(),
+				"code":  "invalid_signature",
 			})
 		}
 
-		// Call the Tapd service to sign the PSBT, knowing it will use the signature.hex file
-		signedPsbt, err := tapdClient.SignVirtualPSBT(cfg.TapdHost, cfg.TapdMacaroon, payload.PSBT)
+		// Only the owner may complete a session, and only once
+		session, err = sendSessions.Claim(payload.SessionID, pubKey)
+		if err != nil {
+			return sessionError(c, err)
+		}
+
+		// Hand the signature to tapd and have it sign the session's vPSBT
+		signedPsbt, err := handoff.Sign(tapdClient, cfg.TapdHost, cfg.TapdMacaroon, session.FundedPSBT, orderedSignatures)
 		if err != nil {
+			sendSessions.Fail(session.ID, err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": err.Error(),
 			})
@@ -147,30 +506,129 @@ func SendComplete(tapdClient tapd.TapdClientInterface) echo.HandlerFunc {
 
 		log.Println("Signed PSBT successfully")
 
-		// now delete the signature.hex and sighash.hex files
-		err = os.Remove(cfg.TaprootSigsDir + "signature.hex")
-		if err != nil {
-			log.Println("Failed to delete signature.hex file", err)
+		if _, err := sendSessions.Transition(session.ID, sessions.StatusSigned, func(s *sessions.Session) {
+			s.SignedPSBT = signedPsbt.SignedPSBT
+		}); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
 		}
-		err = os.Remove(cfg.TaprootSigsDir + "sighash.hex")
-		if err != nil {
-			log.Println("Failed to delete sighash.hex file", err)
+
+		// accepted responds with a session that is not anchored yet
+		accepted := func(pending *sessions.Session) error {
+			if idempotencyKey != "" {
+				body, err := json.Marshal(pending)
+				if err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{
+						"error": err.Error(),
+					})
+				}
+				completions.Complete(pubKey, idempotencyKey, http.StatusAccepted, body)
+				done = true
+				return c.JSONBlob(http.StatusAccepted, body)
+			}
+
+			return c.JSON(http.StatusAccepted, pending)
+		}
+
+		if cosigner != nil {
+			awaiting, err := startCosign(tapdClient, sendSessions, cosigner, cfg, session, signedPsbt.SignedPSBT)
+			if err != nil {
+				sendSessions.Fail(session.ID, err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": err.Error(),
+				})
+			}
+			if awaiting != nil {
+				return accepted(awaiting)
+			}
+		}
+
+		if anchorBatcher != nil && session.BatchID != "" {
+			queued, err := anchorBatcher.Enqueue(session, signedPsbt.SignedPSBT)
+			if err != nil {
+				sendSessions.Fail(session.ID, err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": err.Error(),
+				})
+			}
+
+			return accepted(queued)
 		}
 
 		params := tapd.AnchorVirtualPSBTParams{
-			VirtualPSBTs: []string{signedPsbt.SignedPSBT},
-			TapdHost:     cfg.TapdHost,
-			Macaroon:     cfg.TapdMacaroon,
+			VirtualPSBTs:   []string{signedPsbt.SignedPSBT},
+			AnchorTemplate: tapd.AnchorTemplate(len(session.Recipients)+1, nil),
+			FeeRate:        session.FeeRate,
+			TargetConf:     cfg.DefaultTargetConf,
+			TapdHost:       cfg.TapdHost,
+			Macaroon:       cfg.TapdMacaroon,
+			LNDHost:        cfg.LNDHost,
+			LNDMacaroon:    cfg.LNDMacaroon,
 		}
 
 		// Call the Tapd service to fund the PSBT
 		fundedPsbt, err := tapdClient.AnchorVirtualPSBT(params)
 		if err != nil {
+			sendSessions.Fail(session.ID, err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{
 				"error": err.Error(),
 			})
 		}
 
+		if _, err := sendSessions.Transition(session.ID, sessions.StatusAnchored, func(s *sessions.Session) {
+			s.Transfer = fundedPsbt
+			s.AnchorTxHash = fundedPsbt.AnchorTxHash
+		}); err != nil {
+			log.Printf("Failed to mark send session %s as anchored: %v", session.ID, err)
+		}
+		recordOperatorFees(feeLedger, session, fundedPsbt.AnchorTxHash)
+		recordSpends(policies, session)
+
+		if idempotencyKey != "" {
+			body, err := json.Marshal(fundedPsbt)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": err.Error(),
+				})
+			}
+			completions.Complete(pubKey, idempotencyKey, http.StatusOK, body)
+			done = true
+			return c.JSONBlob(http.StatusOK, body)
+		}
+
 		return c.JSON(http.StatusOK, fundedPsbt)
 	}
 }
+
+// sessionError maps send session errors to HTTP responses.
+func sessionError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, sessions.ErrSessionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, sessions.ErrSessionExpired):
+		status = http.StatusGone
+	case errors.Is(err, sessions.ErrSessionBusy), errors.Is(err, sessions.ErrSessionNotSignable), errors.Is(err, sessions.ErrSessionNotCancellable), errors.Is(err, sessions.ErrSessionNotCosignable):
+		status = http.StatusConflict
+	}
+
+	return c.JSON(status, map[string]string{
+		"error": err.Error(),
+	})
+}
+
+// policyError maps a spending policy violation to a 403 carrying its kind.
+func policyError(c echo.Context, err error) error {
+	var violation *policy.Violation
+	if !errors.As(err, &violation) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusForbidden, map[string]string{
+		"error": violation.Error(),
+		"code":  violation.Code(),
+	})
+}
@@ -0,0 +1,97 @@
+package wallet
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"tajfi-server/config"
+	"tajfi-server/wallet/batch"
+	"tajfi-server/wallet/cosign"
+	"tajfi-server/wallet/operatorfee"
+	"tajfi-server/wallet/policy"
+	"tajfi-server/wallet/scriptkeys"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SweepPayload defines the request payload structure for /send/sweep.
+type SweepPayload struct {
+	AssetID string `json:"asset_id" validate:"required"`
+	SweepDestination
+	FeeOptions
+}
+
+// Sweep starts a send of the caller's entire balance of one asset. Tap
+// addresses carry a fixed amount, so the server creates one for the
+// destination for exactly that balance and spends every owned vUTXO to it,
+// leaving no change. The session is finished through /send/complete.
+func Sweep(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, handoff *tapd.SigHandoff, anchorBatcher *batch.Batcher, cosigner *cosign.Cosigner, feeSchedule *operatorfee.Schedule, policies *policy.Store, scriptKeys *scriptkeys.Store) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var payload SweepPayload
+		ctx := c.Request().Context()
+		pubKey := ctx.Value("public_key").(string)
+		if err := c.Bind(&payload); err != nil || payload.AssetID == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "Invalid request payload",
+			})
+		}
+
+		// Extract config from context
+		cfg := config.GetConfig(ctx)
+
+		utxos, err := tapdClient.GetUtxos(cfg.TapdHost, cfg.TapdMacaroon)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to fetch balances from tapd: "+err.Error())
+		}
+
+		// Other tranches of a grouped asset are left for sweeps of their own,
+		// the group key is kept for the operator fee and spending limits
+		assetFilter := AssetFilterFor(utxos, payload.AssetID)
+		myUtxos := FilterOwnedUtxos(utxos, pubKey, assetFilter, scriptKeys)
+		log.Printf("Sweeping %d UTXOs for pubkey %s", len(myUtxos.Inputs), pubKey)
+
+		params := ReceiveParams{
+			AssetID:      payload.AssetID,
+			GroupKey:     assetFilter.GroupKey,
+			LNDHost:      cfg.LNDHost,
+			LNMacaroon:   cfg.LNDMacaroon,
+			TapdHost:     cfg.TapdHost,
+			TapdMacaroon: cfg.TapdMacaroon,
+			Cosigner:     cosigner,
+		}
+
+		// The operator fee comes out of the swept balance
+		fee := SweepFee(feeSchedule, assetFilter, TotalInputs(myUtxos.Inputs))
+
+		recipient, err := SweepRecipient(params, tapdClient, payload.SweepDestination, myUtxos.Inputs, fee)
+		switch {
+		case errors.Is(err, ErrNothingToSweep), errors.Is(err, ErrInvalidSweepTarget), errors.Is(err, ErrInvalidInternalKey), errors.Is(err, ErrFeeExceedsBalance):
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		case err != nil:
+			return c.JSON(http.StatusInternalServerError, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		recipients := []sessions.Recipient{recipient}
+
+		if fee > 0 {
+			feeRecipient, err := OperatorFeeRecipient(tapdClient, cfg.TapdHost, cfg.TapdMacaroon, payload.AssetID, fee)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error": err.Error(),
+				})
+			}
+			recipients = append(recipients, feeRecipient)
+		}
+
+		if err := CheckPolicy(policies, sendSessions, pubKey, recipients); err != nil {
+			return policyError(c, err)
+		}
+
+		return startSendSession(c, tapdClient, sendSessions, handoff, anchorBatcher, cosigner, scriptKeys, pubKey, recipients, myUtxos.Inputs, payload.FeeOptions)
+	}
+}
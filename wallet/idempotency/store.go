@@ -0,0 +1,109 @@
+package idempotency
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInProgress = errors.New("a request with this Idempotency-Key is still in progress")
+	ErrKeyReused  = errors.New("this Idempotency-Key was already used for a different request")
+)
+
+// MaxKeyLength bounds the Idempotency-Key header.
+const MaxKeyLength = 255
+
+// Result is the stored response of a request that completed successfully.
+type Result struct {
+	Status      int // HTTP status code the request was answered with
+	Body        []byte
+	CompletedAt time.Time
+}
+
+type entry struct {
+	fingerprint string
+	result      *Result
+	expiresAt   time.Time
+}
+
+// Store remembers the outcome of requests by Idempotency-Key, scoped to the
+// caller's public key. A key is reserved while its request runs; only
+// successful results are kept, for ttl, and a failed request frees the key
+// for another try.
+type Store struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*entry
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		ttl:     ttl,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Begin reserves key for pubKey for a request identified by fingerprint. If
+// the key already completed a request with the same fingerprint, its result
+// is returned and nothing is reserved.
+func (s *Store) Begin(pubKey, key, fingerprint string) (*Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune(now)
+
+	e, ok := s.entries[scope(pubKey, key)]
+	if !ok {
+		s.entries[scope(pubKey, key)] = &entry{
+			fingerprint: fingerprint,
+			expiresAt:   now.Add(s.ttl),
+		}
+		return nil, nil
+	}
+	if e.fingerprint != fingerprint {
+		return nil, ErrKeyReused
+	}
+	if e.result == nil {
+		return nil, ErrInProgress
+	}
+	return e.result, nil
+}
+
+// Complete stores status and body as the result of the request holding key.
+func (s *Store) Complete(pubKey, key string, status int, body []byte) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[scope(pubKey, key)]; ok {
+		e.result = &Result{Status: status, Body: body, CompletedAt: now}
+		e.expiresAt = now.Add(s.ttl)
+	}
+}
+
+// Abandon frees key after its request failed.
+func (s *Store) Abandon(pubKey, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[scope(pubKey, key)]; ok && e.result == nil {
+		delete(s.entries, scope(pubKey, key))
+	}
+}
+
+// prune drops expired results. Callers must hold s.mu.
+func (s *Store) prune(now time.Time) {
+	for k, e := range s.entries {
+		if e.result != nil && now.After(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+func scope(pubKey, key string) string {
+	return pubKey + "\x00" + key
+}
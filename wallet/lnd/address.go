@@ -0,0 +1,58 @@
+package lnd
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+)
+
+// NewTaprootScript returns the output script of a fresh taproot address of
+// LND's wallet.
+func NewTaprootScript(lndHost, macaroon string) ([]byte, error) {
+	url := fmt.Sprintf("https://%s/v1/newaddress?type=TAPROOT_PUBKEY", lndHost)
+
+	// Disable TLS verification for simplicity (use with caution!)
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Grpc-Metadata-macaroon", macaroon)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get new address: %s", body)
+	}
+
+	var address struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&address); err != nil {
+		return nil, err
+	}
+
+	// A segwit v1 address holds the 32-byte output key after its version
+	_, data, version, err := bech32.DecodeGeneric(address.Address)
+	if err != nil || version != bech32.VersionM || len(data) == 0 || data[0] != 1 {
+		return nil, fmt.Errorf("LND returned an invalid taproot address %q", address.Address)
+	}
+	key, err := bech32.ConvertBits(data[1:], 5, 8, false)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("LND returned an invalid taproot address %q", address.Address)
+	}
+
+	return append([]byte{0x51, 0x20}, key...), nil
+}
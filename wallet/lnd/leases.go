@@ -0,0 +1,40 @@
+package lnd
+
+import (
+	"bytes"
+	"fmt"
+)
+
+type lease struct {
+	ID       string   `json:"id"`
+	Outpoint OutPoint `json:"outpoint"`
+}
+
+// ReleaseOutputs releases LND's leases on outpoints, whoever took them, so
+// the outputs can fund other transactions. Outpoints are matched by their
+// raw txid.
+func ReleaseOutputs(lndHost, macaroon string, outpoints []OutPoint) error {
+	if len(outpoints) == 0 {
+		return nil
+	}
+
+	var leases struct {
+		LockedUtxos []lease `json:"locked_utxos"`
+	}
+	if err := post(lndHost, macaroon, "/v2/wallet/utxos/leases", map[string]interface{}{}, &leases); err != nil {
+		return fmt.Errorf("failed to list leases: %w", err)
+	}
+
+	for _, l := range leases.LockedUtxos {
+		for _, outpoint := range outpoints {
+			if l.Outpoint.OutputIndex != outpoint.OutputIndex || !bytes.Equal(l.Outpoint.TxidBytes, outpoint.TxidBytes) {
+				continue
+			}
+			var released struct{}
+			if err := post(lndHost, macaroon, "/v2/wallet/utxos/release", l, &released); err != nil {
+				return fmt.Errorf("failed to release %s:%d: %w", l.Outpoint.TxidStr, l.Outpoint.OutputIndex, err)
+			}
+		}
+	}
+	return nil
+}
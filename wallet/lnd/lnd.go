@@ -69,3 +69,143 @@ func GetInternalKey(lndHost, macaroon string) (*InternalKeyResponse, error) {
 
 	return &keyResponse, nil
 }
+
+type FeeEstimateResponse struct {
+	SatPerKw string `json:"sat_per_kw"`
+}
+
+// EstimateFee asks LND's wallet for the fee rate needed to confirm within
+// targetConf blocks.
+func EstimateFee(lndHost, macaroon string, targetConf int) (*FeeEstimateResponse, error) {
+	url := fmt.Sprintf("https://%s/v2/wallet/estimatefee/%d", lndHost, targetConf)
+
+	// Disable TLS verification for simplicity (use with caution!)
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Grpc-Metadata-macaroon", macaroon)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to estimate fee: %s", body)
+	}
+
+	var estimate FeeEstimateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&estimate); err != nil {
+		return nil, err
+	}
+
+	return &estimate, nil
+}
+
+type OutPoint struct {
+	TxidBytes   []byte `json:"txid_bytes,omitempty"`
+	TxidStr     string `json:"txid_str,omitempty"`
+	OutputIndex uint32 `json:"output_index"`
+}
+
+type Utxo struct {
+	AddressType   string   `json:"address_type"`
+	Address       string   `json:"address"`
+	AmountSat     string   `json:"amount_sat"`
+	Outpoint      OutPoint `json:"outpoint"`
+	Confirmations string   `json:"confirmations"`
+}
+
+type ListUnspentResponse struct {
+	Utxos []Utxo `json:"utxos"`
+}
+
+// ListUnconfirmed lists the outputs of LND's wallet that are not confirmed
+// yet, such as the change of anchor transactions still in the mempool.
+func ListUnconfirmed(lndHost, macaroon string) (*ListUnspentResponse, error) {
+	url := fmt.Sprintf("https://%s/v1/utxos?min_confs=0&max_confs=0", lndHost)
+
+	// Disable TLS verification for simplicity (use with caution!)
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Grpc-Metadata-macaroon", macaroon)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to list unspent outputs: %s", body)
+	}
+
+	var unspent ListUnspentResponse
+	if err := json.NewDecoder(resp.Body).Decode(&unspent); err != nil {
+		return nil, err
+	}
+
+	return &unspent, nil
+}
+
+type BumpFeeResponse struct {
+	Status string `json:"status"`
+}
+
+// BumpFee has LND's sweeper spend outpoint, an unconfirmed output of its
+// wallet, in a child transaction paying satPerVbyte, so the parent gets
+// confirmed along with it (CPFP).
+func BumpFee(lndHost, macaroon string, outpoint OutPoint, satPerVbyte uint64) (*BumpFeeResponse, error) {
+	url := fmt.Sprintf("https://%s/v2/wallet/bumpfee", lndHost)
+
+	payload := map[string]interface{}{
+		"outpoint":      outpoint,
+		"sat_per_vbyte": fmt.Sprintf("%d", satPerVbyte),
+		"immediate":     true,
+	}
+	payloadBytes, _ := json.Marshal(payload)
+
+	// Disable TLS verification for simplicity (use with caution!)
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Grpc-Metadata-macaroon", macaroon)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to bump fee: %s", body)
+	}
+
+	var bumped BumpFeeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&bumped); err != nil {
+		return nil, err
+	}
+
+	return &bumped, nil
+}
@@ -0,0 +1,167 @@
+package lnd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// MuSig2Version is the MuSig2 draft LND's signer is asked to follow, the
+// one btcec's musig2 package implements.
+const MuSig2Version = "MUSIG2_VERSION_V100RC2"
+
+type KeyLocator struct {
+	KeyFamily int `json:"key_family"`
+	KeyIndex  int `json:"key_index"`
+}
+
+// MuSig2CreateSessionRequest starts a MuSig2 signing session with one of
+// LND's keys. Byte fields are base64, as LND's REST proxy expects.
+type MuSig2CreateSessionRequest struct {
+	KeyLoc           KeyLocator `json:"key_loc"`
+	AllSignerPubkeys []string   `json:"all_signer_pubkeys"`
+	TaprootTweak     struct {
+		ScriptRoot   string `json:"script_root,omitempty"`
+		KeySpendOnly bool   `json:"key_spend_only"`
+	} `json:"taproot_tweak"`
+	Version string `json:"version"`
+}
+
+type MuSig2CreateSessionResponse struct {
+	SessionID          string `json:"session_id"`
+	CombinedKey        string `json:"combined_key"`
+	TaprootInternalKey string `json:"taproot_internal_key"`
+	LocalPublicNonces  string `json:"local_public_nonces"`
+	HaveAllNonces      bool   `json:"have_all_nonces"`
+}
+
+// MuSig2CreateSession has LND's signer start a MuSig2 session and return its
+// public nonce.
+func MuSig2CreateSession(lndHost, macaroon string, request MuSig2CreateSessionRequest) (*MuSig2CreateSessionResponse, error) {
+	var session MuSig2CreateSessionResponse
+	if err := post(lndHost, macaroon, "/v2/signer/musig2/createsession", request, &session); err != nil {
+		return nil, fmt.Errorf("failed to create MuSig2 session: %w", err)
+	}
+	return &session, nil
+}
+
+// MuSig2RegisterNonces hands LND the public nonces of the other signers of
+// a session.
+func MuSig2RegisterNonces(lndHost, macaroon, sessionID string, nonces []string) error {
+	payload := map[string]interface{}{
+		"session_id":                 sessionID,
+		"other_signer_public_nonces": nonces,
+	}
+	var resp struct {
+		HaveAllNonces bool `json:"have_all_nonces"`
+	}
+	if err := post(lndHost, macaroon, "/v2/signer/musig2/registernonces", payload, &resp); err != nil {
+		return fmt.Errorf("failed to register MuSig2 nonces: %w", err)
+	}
+	if !resp.HaveAllNonces {
+		return fmt.Errorf("LND is still missing nonces of MuSig2 session")
+	}
+	return nil
+}
+
+// MuSig2Sign has LND create its partial signature of messageDigest in a
+// session, which uses up its nonce.
+func MuSig2Sign(lndHost, macaroon, sessionID, messageDigest string) (string, error) {
+	payload := map[string]interface{}{
+		"session_id":     sessionID,
+		"message_digest": messageDigest,
+	}
+	var resp struct {
+		LocalPartialSignature string `json:"local_partial_signature"`
+	}
+	if err := post(lndHost, macaroon, "/v2/signer/musig2/sign", payload, &resp); err != nil {
+		return "", fmt.Errorf("failed to create MuSig2 partial signature: %w", err)
+	}
+	return resp.LocalPartialSignature, nil
+}
+
+// MuSig2CombineSig has LND combine its partial signature of a session with
+// those of the other signers into the final signature.
+func MuSig2CombineSig(lndHost, macaroon, sessionID string, partialSignatures []string) (string, error) {
+	payload := map[string]interface{}{
+		"session_id":               sessionID,
+		"other_partial_signatures": partialSignatures,
+	}
+	var resp struct {
+		HaveAllSignatures bool   `json:"have_all_signatures"`
+		FinalSignature    string `json:"final_signature"`
+	}
+	if err := post(lndHost, macaroon, "/v2/signer/musig2/combinesig", payload, &resp); err != nil {
+		return "", fmt.Errorf("failed to combine MuSig2 signatures: %w", err)
+	}
+	if !resp.HaveAllSignatures {
+		return "", fmt.Errorf("LND is still missing partial signatures of MuSig2 session")
+	}
+	return resp.FinalSignature, nil
+}
+
+// MuSig2Cleanup has LND forget a MuSig2 session that will never be
+// signed, along with its secret nonce.
+func MuSig2Cleanup(lndHost, macaroon, sessionID string) error {
+	payload := map[string]interface{}{
+		"session_id": sessionID,
+	}
+	var resp struct{}
+	if err := post(lndHost, macaroon, "/v2/signer/musig2/cleanup", payload, &resp); err != nil {
+		return fmt.Errorf("failed to clean up MuSig2 session: %w", err)
+	}
+	return nil
+}
+
+type FinalizePsbtResponse struct {
+	SignedPsbt string `json:"signed_psbt"`
+	RawFinalTx string `json:"raw_final_tx"`
+}
+
+// FinalizePsbt has LND sign the inputs of a base64 PSBT that belong to its
+// wallet and finalize it. Inputs signed elsewhere must be final already.
+func FinalizePsbt(lndHost, macaroon, psbt string) (*FinalizePsbtResponse, error) {
+	payload := map[string]interface{}{
+		"funded_psbt": psbt,
+	}
+	var finalized FinalizePsbtResponse
+	if err := post(lndHost, macaroon, "/v2/wallet/psbt/finalize", payload, &finalized); err != nil {
+		return nil, fmt.Errorf("failed to finalize PSBT: %w", err)
+	}
+	return &finalized, nil
+}
+
+// post sends payload to one of LND's REST endpoints and decodes the
+// response into out.
+func post(lndHost, macaroon, path string, payload, out interface{}) error {
+	url := fmt.Sprintf("https://%s%s", lndHost, path)
+	payloadBytes, _ := json.Marshal(payload)
+
+	// Disable TLS verification for simplicity (use with caution!)
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Grpc-Metadata-macaroon", macaroon)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s", body)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -1,5 +1,13 @@
 package wallet
 
+import (
+	"tajfi-server/wallet/cosign"
+	"tajfi-server/wallet/lnd"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+	"time"
+)
+
 type Transfer struct {
 	Txid         string `json:"txid"`
 	Timestamp    string `json:"timestamp"`
@@ -9,6 +17,32 @@ type Transfer struct {
 	Amount       uint64 `json:"amount"`
 	Status       string `json:"status"`        // confirmed or unconfirmed
 	ChangeAmount uint64 `json:"change_amount"` // only relevant for sends
+	// ProofDeliveries is the state of delivering each output's proof to its
+	// receiver's courier
+	ProofDeliveries []ProofDelivery `json:"proof_deliveries,omitempty"`
+	// FeeBump is set once the anchor transaction is stuck or was fee bumped
+	FeeBump *FeeBump `json:"fee_bump,omitempty"`
+}
+
+// ProofDelivery is the delivery state of one transfer output's proof.
+type ProofDelivery struct {
+	Outpoint  string `json:"outpoint"`
+	ScriptKey string `json:"script_key"`
+	Amount    uint64 `json:"amount"`
+	Status    string `json:"status"` // pending or complete
+	// Stuck is set once the delivery has been pending for too long
+	Stuck bool `json:"stuck,omitempty"`
+}
+
+// FeeBump is the fee bumping state of a transfer's anchor transaction.
+type FeeBump struct {
+	Stuck bool `json:"stuck"`
+	Bumps int  `json:"bumps"`
+	// FeeRate and Outpoint are those of the latest CPFP child, which spends
+	// Outpoint of the anchor transaction
+	FeeRate  uint64     `json:"fee_rate,omitempty"`
+	Outpoint string     `json:"outpoint,omitempty"`
+	BumpedAt *time.Time `json:"bumped_at,omitempty"`
 }
 
 type Wallet struct {
@@ -18,11 +52,79 @@ type Wallet struct {
 
 // SendStartParams holds parameters needed to start a send operation.
 type ReceiveParams struct {
-	PubKey       string
-	AssetID      string
-	Amount       int
+	PubKey  string
+	AssetID string
+	Amount  int
+	// GroupKey is the group of AssetID, if any, which recipients made from
+	// these params carry for spending limits
+	GroupKey     string
 	LNDHost      string
 	LNMacaroon   string
 	TapdHost     string
 	TapdMacaroon string
+	// ScriptKey is the x-only script key of the address when it is not
+	// PubKey itself, such as one derived for the user
+	ScriptKey string
+	// InternalKey is used instead of a fresh key from LND when set
+	InternalKey *lnd.InternalKeyResponse
+	// Cosigner makes the anchor internal key a MuSig2 key of the server and
+	// the user when set
+	Cosigner *cosign.Cosigner
+	// DryRun leaves recipients without an address instead of minting one
+	DryRun bool
+}
+
+// SendStartResponse is the funded vPSBT returned by /send/start together with
+// the signing session it belongs to.
+type SendStartResponse struct {
+	*tapd.FundVirtualPSBTResponse
+	SessionID   string                  `json:"session_id"`
+	ExpiresAt   time.Time               `json:"expires_at"`
+	Sighashes   []sessions.InputSighash `json:"sighashes"`
+	FeeEstimate *FeeEstimate            `json:"fee_estimate,omitempty"`
+	OperatorFee uint64                  `json:"operator_fee,omitempty"`
+}
+
+// SendPlan is what a dry run of /send/start reports instead of opening a
+// signing session.
+type SendPlan struct {
+	AssetFilter
+	Sufficient        bool                 `json:"sufficient"`
+	Available         uint64               `json:"available"`
+	Inputs            []PlanInput          `json:"inputs"`
+	Outputs           []sessions.Recipient `json:"outputs"`
+	TotalInputs       uint64               `json:"total_inputs"`
+	TotalOutputs      uint64               `json:"total_outputs"`
+	OperatorFee       uint64               `json:"operator_fee"`
+	Change            uint64               `json:"change"`
+	ChangeOutputIndex *int                 `json:"change_output_index,omitempty"`
+	FeeEstimate       *FeeEstimate         `json:"fee_estimate,omitempty"`
+}
+
+// PlanInput is one vUTXO a planned send would spend.
+type PlanInput struct {
+	Outpoint    string `json:"outpoint"`
+	Amount      uint64 `json:"amount"`
+	BlockHeight int    `json:"block_height,omitempty"`
+}
+
+// FeeOptions lets a client choose the anchor fee of a send, either as a rate
+// or as a confirmation target to estimate the rate for.
+type FeeOptions struct {
+	FeeRate    uint64 `json:"fee_rate"` // sat/vB
+	TargetConf int    `json:"target_conf"`
+}
+
+// FeeEstimate previews the on-chain cost of anchoring a send.
+type FeeEstimate struct {
+	FeeRate    uint64 `json:"fee_rate"` // sat/vB
+	TargetConf int    `json:"target_conf,omitempty"`
+	Vsize      uint64 `json:"estimated_vsize"`
+	Fee        uint64 `json:"estimated_fee"` // sats
+}
+
+// InputSignature is the user's signature for one vPSBT input.
+type InputSignature struct {
+	InputIndex   int    `json:"input_index"`
+	SignatureHex string `json:"signature_hex"`
 }
@@ -0,0 +1,115 @@
+package operatorfee
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is an operator fee collected by an anchored send.
+type Entry struct {
+	SessionID    string    `json:"session_id"`
+	AssetID      string    `json:"asset_id"`
+	Amount       uint64    `json:"amount"`
+	AnchorTxHash string    `json:"anchor_tx_hash"`
+	CollectedAt  time.Time `json:"collected_at"`
+}
+
+// AssetTotal sums the fees collected in one asset.
+type AssetTotal struct {
+	AssetID string `json:"asset_id"`
+	Total   uint64 `json:"total"`
+	Count   int    `json:"count"`
+}
+
+// Report is the collected fees per asset since a point in time.
+type Report struct {
+	Since   *time.Time            `json:"since,omitempty"`
+	Totals  map[string]AssetTotal `json:"totals"`
+	Entries []Entry               `json:"entries"`
+}
+
+// Ledger records collected operator fees in memory and, when path is set,
+// persists them to a JSON file.
+type Ledger struct {
+	mu      sync.Mutex
+	path    string
+	entries []Entry
+}
+
+// LoadLedger opens the fee ledger at path, starting empty if the file does
+// not exist yet.
+func LoadLedger(path string) (*Ledger, error) {
+	l := &Ledger{path: path}
+	if path == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &l.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Record adds a collected fee.
+func (l *Ledger) Record(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+	return l.saveLocked()
+}
+
+// Report sums the fees collected since since, or all of them if it is zero.
+func (l *Ledger) Report(since time.Time) Report {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	report := Report{
+		Totals:  make(map[string]AssetTotal),
+		Entries: []Entry{},
+	}
+	if !since.IsZero() {
+		report.Since = &since
+	}
+	for _, entry := range l.entries {
+		if entry.CollectedAt.Before(since) {
+			continue
+		}
+
+		total := report.Totals[entry.AssetID]
+		total.AssetID = entry.AssetID
+		total.Total += entry.Amount
+		total.Count++
+		report.Totals[entry.AssetID] = total
+		report.Entries = append(report.Entries, entry)
+	}
+	return report
+}
+
+func (l *Ledger) saveLocked() error {
+	if l.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write fee ledger: %w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
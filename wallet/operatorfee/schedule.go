@@ -0,0 +1,94 @@
+package operatorfee
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"os"
+	"strings"
+)
+
+// Rate is the operator fee charged on a send, in basis points of the amount
+// sent, bounded by Min and, if set, Max. Amounts are in asset units.
+type Rate struct {
+	RateBps uint64 `json:"rate_bps"`
+	Min     uint64 `json:"min"`
+	Max     uint64 `json:"max,omitempty"`
+}
+
+// Schedule holds the fee rates per asset. Assets are keyed by asset ID or
+// group key; assets not listed pay Default. A nil Schedule charges nothing.
+type Schedule struct {
+	Default *Rate           `json:"default,omitempty"`
+	Assets  map[string]Rate `json:"assets,omitempty"`
+}
+
+// LoadSchedule reads a fee schedule from a JSON file. An empty path means no
+// operator fees.
+func LoadSchedule(path string) (*Schedule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule Schedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	// Group keys are hex and matched case-insensitively
+	assets := make(map[string]Rate, len(schedule.Assets))
+	for key, rate := range schedule.Assets {
+		assets[strings.ToLower(key)] = rate
+	}
+	schedule.Assets = assets
+
+	return &schedule, nil
+}
+
+// FeeFor returns the fee on sending amount of the asset with assetID, or of
+// the group with groupKey if it has a rate of its own.
+func (s *Schedule) FeeFor(assetID, groupKey string, amount uint64) uint64 {
+	if s == nil {
+		return 0
+	}
+
+	rate, ok := s.Assets[strings.ToLower(assetID)]
+	if !ok && groupKey != "" {
+		rate, ok = s.Assets[strings.ToLower(groupKey)]
+	}
+	if !ok {
+		if s.Default == nil {
+			return 0
+		}
+		rate = *s.Default
+	}
+
+	return rate.Apply(amount)
+}
+
+// Apply returns the fee the rate charges on amount, rounded up. A fee too
+// large for a uint64 is clamped to the largest one, or Max if set.
+func (r Rate) Apply(amount uint64) uint64 {
+	// amount*RateBps+9999 as a 128-bit number, so large amounts cannot wrap
+	hi, lo := bits.Mul64(amount, r.RateBps)
+	lo, carry := bits.Add64(lo, 9999, 0)
+	hi += carry
+
+	fee := uint64(math.MaxUint64)
+	if hi < 10000 {
+		fee, _ = bits.Div64(hi, lo, 10000)
+	}
+	if fee < r.Min {
+		fee = r.Min
+	}
+	if r.Max > 0 && fee > r.Max {
+		fee = r.Max
+	}
+	return fee
+}
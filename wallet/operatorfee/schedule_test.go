@@ -0,0 +1,25 @@
+package operatorfee
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRateApply(t *testing.T) {
+	for name, tc := range map[string]struct {
+		rate   Rate
+		amount uint64
+		want   uint64
+	}{
+		"rounded up":          {Rate{RateBps: 10}, 1001, 2},
+		"min":                 {Rate{RateBps: 10, Min: 5}, 100, 5},
+		"max":                 {Rate{RateBps: 10, Max: 3}, 100000, 3},
+		"large amount":        {Rate{RateBps: 10}, math.MaxUint64, math.MaxUint64/1000 + 1},
+		"too large, clamped":  {Rate{RateBps: 20000}, math.MaxUint64, math.MaxUint64},
+		"too large, then max": {Rate{RateBps: 20000, Max: 7}, math.MaxUint64, 7},
+	} {
+		if got := tc.rate.Apply(tc.amount); got != tc.want {
+			t.Errorf("%s: Apply(%d) = %d, want %d", name, tc.amount, got, tc.want)
+		}
+	}
+}
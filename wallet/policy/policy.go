@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of policy violation. Check wraps one of these in a *Violation.
+var (
+	ErrAccountCooldown       = errors.New("new accounts cannot send yet")
+	ErrMaxTransferExceeded   = errors.New("the send exceeds the maximum single transfer")
+	ErrDailyLimitExceeded    = errors.New("the send exceeds the daily limit")
+	ErrWeeklyLimitExceeded   = errors.New("the send exceeds the weekly limit")
+	ErrDestinationNotAllowed = errors.New("the destination is not on the allowed list")
+)
+
+var (
+	ErrInvalidPolicy  = errors.New("invalid policy")
+	ErrPolicyNotFound = errors.New("policy not found")
+)
+
+var violationCodes = map[error]string{
+	ErrAccountCooldown:       "account_cooldown",
+	ErrMaxTransferExceeded:   "max_transfer_exceeded",
+	ErrDailyLimitExceeded:    "daily_limit_exceeded",
+	ErrWeeklyLimitExceeded:   "weekly_limit_exceeded",
+	ErrDestinationNotAllowed: "destination_not_allowed",
+}
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+// Violation is a send refused by a policy.
+type Violation struct {
+	Kind   error
+	Detail string
+}
+
+func (v *Violation) Error() string {
+	return v.Kind.Error() + ": " + v.Detail
+}
+
+func (v *Violation) Unwrap() error {
+	return v.Kind
+}
+
+// Code is the machine readable kind of the violation.
+func (v *Violation) Code() string {
+	return violationCodes[v.Kind]
+}
+
+// Limits caps what a user may send of one asset. Zero means no limit.
+type Limits struct {
+	MaxTransfer uint64 `json:"max_transfer,omitempty"`
+	// Daily and Weekly apply over the rolling last 24 hours and 7 days
+	Daily  uint64 `json:"daily,omitempty"`
+	Weekly uint64 `json:"weekly,omitempty"`
+}
+
+// Policy restricts the sends of a user.
+type Policy struct {
+	// Assets holds the limits per asset ID or group key. Assets without an
+	// entry are not limited.
+	Assets map[string]Limits `json:"assets,omitempty"`
+	// AllowedDestinations lists the tap addresses or script keys a user may
+	// pay. An empty list allows any destination.
+	AllowedDestinations []string `json:"allowed_destinations,omitempty"`
+	// NewAccountCooldownHours blocks sends until an account was first
+	// connected this many hours ago.
+	NewAccountCooldownHours int       `json:"new_account_cooldown_hours,omitempty"`
+	UpdatedAt               time.Time `json:"updated_at"`
+}
+
+// Validate checks the policy is well formed and normalizes its keys.
+func (p *Policy) Validate() error {
+	if p.NewAccountCooldownHours < 0 {
+		return fmt.Errorf("%w: new_account_cooldown_hours cannot be negative", ErrInvalidPolicy)
+	}
+
+	assets := make(map[string]Limits, len(p.Assets))
+	for key, limits := range p.Assets {
+		if key == "" {
+			return fmt.Errorf("%w: asset limits need an asset ID or group key", ErrInvalidPolicy)
+		}
+		if limits.Daily > 0 && limits.Weekly > 0 && limits.Daily > limits.Weekly {
+			return fmt.Errorf("%w: daily limit of %s is above its weekly limit", ErrInvalidPolicy, key)
+		}
+		assets[strings.ToLower(key)] = limits
+	}
+	p.Assets = assets
+
+	for i, destination := range p.AllowedDestinations {
+		if destination == "" {
+			return fmt.Errorf("%w: allowed destination %d is empty", ErrInvalidPolicy, i)
+		}
+	}
+	return nil
+}
+
+// limitsFor returns the limits for an asset and the key they are kept
+// under, preferring those of its group.
+func (p *Policy) limitsFor(assetID, groupKey string) (Limits, string, bool) {
+	if groupKey != "" {
+		key := strings.ToLower(groupKey)
+		if limits, ok := p.Assets[key]; ok {
+			return limits, key, true
+		}
+	}
+	key := strings.ToLower(assetID)
+	limits, ok := p.Assets[key]
+	return limits, key, ok
+}
+
+// allows reports whether transfer pays an allowed destination.
+func (p *Policy) allows(transfer Transfer) bool {
+	if len(p.AllowedDestinations) == 0 {
+		return true
+	}
+	for _, destination := range p.AllowedDestinations {
+		if destination == transfer.Address {
+			return true
+		}
+		if transfer.ScriptKey != "" && xOnly(destination) == xOnly(transfer.ScriptKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// Transfer is one output of a send paying someone other than the sender.
+type Transfer struct {
+	AssetID   string `json:"asset_id"`
+	GroupKey  string `json:"group_key,omitempty"`
+	Amount    uint64 `json:"amount"`
+	Address   string `json:"-"`
+	ScriptKey string `json:"-"`
+}
+
+// matches reports whether t counts towards the limits kept under key.
+func (t Transfer) matches(key string) bool {
+	return strings.EqualFold(t.AssetID, key) || (t.GroupKey != "" && strings.EqualFold(t.GroupKey, key))
+}
+
+// xOnly strips the parity byte of a compressed public key so it compares
+// equal to its x-only form.
+func xOnly(key string) string {
+	key = strings.ToLower(key)
+	if len(key) == 66 {
+		return key[2:]
+	}
+	return key
+}
@@ -0,0 +1,336 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultKey addresses the policy of users without one of their own.
+const DefaultKey = "default"
+
+// Spend is a transfer of an anchored send, kept for a week to enforce the
+// daily and weekly limits.
+type Spend struct {
+	PublicKey string `json:"public_key"`
+	SessionID string `json:"session_id"`
+	Transfer
+	SentAt time.Time `json:"sent_at"`
+}
+
+// Policies lists the default policy and those of individual users.
+type Policies struct {
+	Default *Policy            `json:"default"`
+	Users   map[string]*Policy `json:"users"`
+}
+
+type state struct {
+	Policies
+	// Accounts holds when each public key first connected
+	Accounts map[string]time.Time `json:"accounts"`
+	Spends   []Spend              `json:"spends"`
+}
+
+// Store keeps spending policies, account ages and recent spends in memory
+// and, when path is set, persists them to a JSON file.
+type Store struct {
+	mu    sync.Mutex
+	path  string
+	state state
+}
+
+// LoadStore opens the policy store at path, which may not exist yet. An
+// empty path keeps everything in memory only.
+func LoadStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, err
+		default:
+			if err := json.Unmarshal(data, &s.state); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+		}
+	}
+
+	if s.state.Users == nil {
+		s.state.Users = make(map[string]*Policy)
+	}
+	if s.state.Accounts == nil {
+		s.state.Accounts = make(map[string]time.Time)
+	}
+	return s, nil
+}
+
+// List returns copies of every policy.
+func (s *Store) List() Policies {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policies := Policies{Users: make(map[string]*Policy, len(s.state.Users))}
+	if s.state.Default != nil {
+		policies.Default = s.state.Default.clone()
+	}
+	for pubKey, policy := range s.state.Users {
+		policies.Users[pubKey] = policy.clone()
+	}
+	return policies
+}
+
+// Get returns a copy of the policy stored under key, a public key or
+// DefaultKey.
+func (s *Store) Get(key string) (*Policy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy := s.lookupLocked(strings.ToLower(key))
+	if policy == nil {
+		return nil, ErrPolicyNotFound
+	}
+	return policy.clone(), nil
+}
+
+// Put validates policy and stores it under key, replacing any policy there.
+func (s *Store) Put(key string, policy Policy) (*Policy, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	policy.UpdatedAt = time.Now().UTC()
+	key = strings.ToLower(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.lookupLocked(key)
+	s.setLocked(key, &policy)
+	if err := s.saveLocked(); err != nil {
+		s.setLocked(key, previous)
+		return nil, err
+	}
+	return policy.clone(), nil
+}
+
+// Delete removes the policy stored under key.
+func (s *Store) Delete(key string) error {
+	key = strings.ToLower(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.lookupLocked(key)
+	if previous == nil {
+		return ErrPolicyNotFound
+	}
+	s.setLocked(key, nil)
+	if err := s.saveLocked(); err != nil {
+		s.setLocked(key, previous)
+		return err
+	}
+	return nil
+}
+
+// Seen records that pubKey connected at at, unless it connected before.
+func (s *Store) Seen(pubKey string, at time.Time) error {
+	pubKey = strings.ToLower(pubKey)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Accounts[pubKey]; ok {
+		return nil
+	}
+	s.state.Accounts[pubKey] = at.UTC()
+	return s.saveLocked()
+}
+
+// Check returns a *Violation if the policy of pubKey forbids a send made of
+// transfers at now. pending holds the transfers of the user's sends that
+// have been started but not anchored yet, which count towards the limits.
+// An account with no first connection recorded is taken as first seen now.
+func (s *Store) Check(pubKey string, transfers, pending []Transfer, now time.Time) error {
+	pubKey = strings.ToLower(pubKey)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy := s.state.Users[pubKey]
+	if policy == nil {
+		policy = s.state.Default
+	}
+	if policy == nil || len(transfers) == 0 {
+		return nil
+	}
+
+	if policy.NewAccountCooldownHours > 0 {
+		firstSeen, ok := s.state.Accounts[pubKey]
+		if !ok {
+			firstSeen = now
+		}
+		allowedFrom := firstSeen.Add(time.Duration(policy.NewAccountCooldownHours) * time.Hour)
+		if now.Before(allowedFrom) {
+			return &Violation{
+				Kind:   ErrAccountCooldown,
+				Detail: "sends are allowed from " + allowedFrom.Format(time.RFC3339),
+			}
+		}
+	}
+
+	for _, transfer := range transfers {
+		if !policy.allows(transfer) {
+			return &Violation{
+				Kind:   ErrDestinationNotAllowed,
+				Detail: transfer.Address,
+			}
+		}
+	}
+
+	// Sum the send per limited asset, in the order the transfers came in
+	var keys []string
+	amounts := make(map[string]uint64)
+	limitsByKey := make(map[string]Limits)
+	for _, transfer := range transfers {
+		limits, key, ok := policy.limitsFor(transfer.AssetID, transfer.GroupKey)
+		if !ok {
+			continue
+		}
+		if _, seen := amounts[key]; !seen {
+			keys = append(keys, key)
+			limitsByKey[key] = limits
+		}
+		amounts[key] += transfer.Amount
+	}
+
+	for _, key := range keys {
+		limits, amount := limitsByKey[key], amounts[key]
+
+		if limits.MaxTransfer > 0 && amount > limits.MaxTransfer {
+			return &Violation{
+				Kind:   ErrMaxTransferExceeded,
+				Detail: fmt.Sprintf("sending %d of %s but at most %d may be sent at once", amount, key, limits.MaxTransfer),
+			}
+		}
+
+		inFlight := sum(pending, key)
+		if limits.Daily > 0 {
+			used := s.spentLocked(pubKey, key, now.Add(-day)) + inFlight
+			if used+amount > limits.Daily {
+				return &Violation{
+					Kind:   ErrDailyLimitExceeded,
+					Detail: fmt.Sprintf("%d of %s already sent or pending in the last 24 hours, the limit is %d", used, key, limits.Daily),
+				}
+			}
+		}
+		if limits.Weekly > 0 {
+			used := s.spentLocked(pubKey, key, now.Add(-week)) + inFlight
+			if used+amount > limits.Weekly {
+				return &Violation{
+					Kind:   ErrWeeklyLimitExceeded,
+					Detail: fmt.Sprintf("%d of %s already sent or pending in the last 7 days, the limit is %d", used, key, limits.Weekly),
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Record adds the transfers of an anchored send to the spends of pubKey and
+// drops spends too old to count towards any limit.
+func (s *Store) Record(pubKey, sessionID string, transfers []Transfer, at time.Time) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+	pubKey = strings.ToLower(pubKey)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spends := s.state.Spends[:0]
+	for _, spend := range s.state.Spends {
+		if spend.SentAt.After(at.Add(-week)) {
+			spends = append(spends, spend)
+		}
+	}
+	for _, transfer := range transfers {
+		spends = append(spends, Spend{
+			PublicKey: pubKey,
+			SessionID: sessionID,
+			Transfer:  transfer,
+			SentAt:    at.UTC(),
+		})
+	}
+	s.state.Spends = spends
+	return s.saveLocked()
+}
+
+func (s *Store) lookupLocked(key string) *Policy {
+	if key == DefaultKey {
+		return s.state.Default
+	}
+	return s.state.Users[key]
+}
+
+func (s *Store) setLocked(key string, policy *Policy) {
+	switch {
+	case key == DefaultKey:
+		s.state.Default = policy
+	case policy == nil:
+		delete(s.state.Users, key)
+	default:
+		s.state.Users[key] = policy
+	}
+}
+
+// spentLocked sums what pubKey sent of the asset kept under key since since.
+func (s *Store) spentLocked(pubKey, key string, since time.Time) uint64 {
+	var total uint64
+	for _, spend := range s.state.Spends {
+		if spend.PublicKey == pubKey && spend.SentAt.After(since) && spend.matches(key) {
+			total += spend.Amount
+		}
+	}
+	return total
+}
+
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write policies: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// sum adds up the transfers counting towards the limits kept under key.
+func sum(transfers []Transfer, key string) (total uint64) {
+	for _, transfer := range transfers {
+		if transfer.matches(key) {
+			total += transfer.Amount
+		}
+	}
+	return total
+}
+
+func (p *Policy) clone() *Policy {
+	c := *p
+	c.Assets = make(map[string]Limits, len(p.Assets))
+	for key, limits := range p.Assets {
+		c.Assets[key] = limits
+	}
+	c.AllowedDestinations = append([]string(nil), p.AllowedDestinations...)
+	return &c
+}
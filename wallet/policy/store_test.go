@@ -0,0 +1,32 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCooldownAppliesToUnseenAccounts(t *testing.T) {
+	store, err := LoadStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(DefaultKey, Policy{NewAccountCooldownHours: 24}); err != nil {
+		t.Fatal(err)
+	}
+	transfers := []Transfer{{AssetID: "asset", Amount: 1}}
+	now := time.Now()
+
+	var violation *Violation
+	err = store.Check("unseen", transfers, nil, now)
+	if !errors.As(err, &violation) || !errors.Is(violation.Kind, ErrAccountCooldown) {
+		t.Fatalf("err = %v, want an account cooldown", err)
+	}
+
+	if err := store.Seen("old", now.Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Check("old", transfers, nil, now); err != nil {
+		t.Fatalf("err = %v, want the send allowed after the cooldown", err)
+	}
+}
@@ -0,0 +1,259 @@
+package proofs
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"tajfi-server/wallet/tapd"
+	"time"
+)
+
+var (
+	ErrDeliveryNotFound = errors.New("no stuck proof delivery for that output")
+	ErrNoCourier        = errors.New("re-delivery needs ProofCourierAddr to be set")
+)
+
+// Delivery is a transfer output whose proof tapd has not managed to deliver
+// to the receiver's courier.
+type Delivery struct {
+	AnchorTxHash     string     `json:"anchor_tx_hash"`
+	Outpoint         string     `json:"outpoint"`
+	AssetID          string     `json:"asset_id"`
+	ScriptKey        string     `json:"script_key"`
+	Amount           uint64     `json:"amount"`
+	PendingSince     time.Time  `json:"pending_since"`
+	Redeliveries     int        `json:"redeliveries"`
+	LastRedeliveryAt *time.Time `json:"last_redelivery_at,omitempty"`
+	LastError        string     `json:"last_error,omitempty"`
+}
+
+// Options configures a Watcher.
+type Options struct {
+	TapdHost     string
+	TapdMacaroon string
+	// StuckAfter is how long a delivery may stay pending before it is
+	// flagged, and how long to wait between automatic re-deliveries
+	StuckAfter time.Duration
+	// Courier is the universe server proofs are re-delivered to, re-delivery
+	// is disabled when empty
+	Courier       string
+	AutoRedeliver bool
+	// MaxAttempts caps automatic re-deliveries of one output
+	MaxAttempts int
+}
+
+// Watcher polls tapd's transfers for proof deliveries that stay pending,
+// flags them and, when enabled, has tapd deliver them again.
+type Watcher struct {
+	mu         sync.Mutex
+	tapdClient tapd.TapdClientInterface
+	opts       Options
+	// firstSeen holds when pending outputs without a usable transfer
+	// timestamp were first seen
+	firstSeen map[string]time.Time
+	stuck     map[string]*Delivery
+}
+
+func NewWatcher(tapdClient tapd.TapdClientInterface, opts Options) *Watcher {
+	return &Watcher{
+		tapdClient: tapdClient,
+		opts:       opts,
+		firstSeen:  make(map[string]time.Time),
+		stuck:      make(map[string]*Delivery),
+	}
+}
+
+// Run checks for stuck deliveries every interval until the process exits.
+// A zero interval disables the watcher.
+func (w *Watcher) Run(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := w.Check(now); err != nil {
+			log.Printf("Failed to check proof deliveries: %v", err)
+		}
+	}
+}
+
+// Check flags the outputs whose proof delivery has been pending for longer
+// than StuckAfter and forgets those tapd has delivered since. With
+// AutoRedeliver set, stuck deliveries are pushed again, at most MaxAttempts
+// times each and no more often than every StuckAfter.
+func (w *Watcher) Check(now time.Time) error {
+	transfers, err := w.tapdClient.GetTransfers(w.opts.TapdHost, w.opts.TapdMacaroon)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	pending := make(map[string]bool)
+	for _, transfer := range transfers.Transfers {
+		for _, output := range transfer.Outputs {
+			if output.ProofDeliveryStatus != tapd.ProofDeliveryPending {
+				continue
+			}
+			key := deliveryKey(output.Anchor.Outpoint, output.ScriptKey)
+			pending[key] = true
+
+			since, ok := transferTime(transfer.TransferTimestamp)
+			if !ok {
+				if _, seen := w.firstSeen[key]; !seen {
+					w.firstSeen[key] = now
+				}
+				since = w.firstSeen[key]
+			}
+			if now.Sub(since) < w.opts.StuckAfter {
+				continue
+			}
+
+			if _, flagged := w.stuck[key]; !flagged {
+				delivery := newDelivery(transfer, output, since)
+				log.Printf("Proof delivery of %s to %s has been pending since %s", delivery.Outpoint, delivery.ScriptKey, since.Format(time.RFC3339))
+				w.stuck[key] = delivery
+			}
+		}
+	}
+
+	// Drop what tapd has delivered, or no longer reports
+	for key := range w.stuck {
+		if !pending[key] {
+			delete(w.stuck, key)
+		}
+	}
+	for key := range w.firstSeen {
+		if !pending[key] {
+			delete(w.firstSeen, key)
+		}
+	}
+
+	var due []string
+	if w.opts.AutoRedeliver && w.opts.Courier != "" {
+		for key, delivery := range w.stuck {
+			if delivery.Redeliveries >= w.opts.MaxAttempts {
+				continue
+			}
+			if delivery.LastRedeliveryAt != nil && now.Sub(*delivery.LastRedeliveryAt) < w.opts.StuckAfter {
+				continue
+			}
+			due = append(due, key)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, key := range due {
+		if _, err := w.redeliver(key, now); err != nil {
+			log.Printf("Failed to re-deliver proof %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// Stuck lists the flagged deliveries, oldest first.
+func (w *Watcher) Stuck() []Delivery {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	stuck := make([]Delivery, 0, len(w.stuck))
+	for _, delivery := range w.stuck {
+		stuck = append(stuck, *delivery)
+	}
+	sort.Slice(stuck, func(i, j int) bool {
+		return stuck[i].PendingSince.Before(stuck[j].PendingSince)
+	})
+	return stuck
+}
+
+// IsStuck reports whether the delivery of the output at outpoint to
+// scriptKey is flagged.
+func (w *Watcher) IsStuck(outpoint, scriptKey string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, ok := w.stuck[deliveryKey(outpoint, scriptKey)]
+	return ok
+}
+
+// Redeliver has tapd push the proof of a flagged output to the courier
+// again. It returns the delivery with the attempt recorded.
+func (w *Watcher) Redeliver(outpoint, scriptKey string) (*Delivery, error) {
+	return w.redeliver(deliveryKey(outpoint, scriptKey), time.Now())
+}
+
+func (w *Watcher) redeliver(key string, now time.Time) (*Delivery, error) {
+	if w.opts.Courier == "" {
+		return nil, ErrNoCourier
+	}
+
+	w.mu.Lock()
+	delivery, ok := w.stuck[key]
+	if !ok {
+		w.mu.Unlock()
+		return nil, ErrDeliveryNotFound
+	}
+	params := tapd.PushProofParams{
+		AssetID:   delivery.AssetID,
+		Outpoint:  delivery.Outpoint,
+		ScriptKey: delivery.ScriptKey,
+		Server:    w.opts.Courier,
+	}
+	w.mu.Unlock()
+
+	err := w.tapdClient.PushProof(w.opts.TapdHost, w.opts.TapdMacaroon, params)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// The delivery may have completed while tapd was pushing
+	if delivery, ok = w.stuck[key]; !ok {
+		return nil, ErrDeliveryNotFound
+	}
+	attemptedAt := now.UTC()
+	delivery.Redeliveries++
+	delivery.LastRedeliveryAt = &attemptedAt
+	delivery.LastError = ""
+	if err != nil {
+		delivery.LastError = err.Error()
+		return nil, err
+	}
+
+	log.Printf("Re-delivered proof of %s to %s via %s", delivery.Outpoint, delivery.ScriptKey, w.opts.Courier)
+	d := *delivery
+	return &d, nil
+}
+
+func newDelivery(transfer tapd.AssetTransferResponse, output tapd.TransferOutput, since time.Time) *Delivery {
+	assetID := output.AssetID
+	if assetID == "" && len(transfer.Inputs) > 0 {
+		assetID = transfer.Inputs[0].AssetID
+	}
+	amount, _ := strconv.ParseUint(output.Amount, 10, 64)
+
+	return &Delivery{
+		AnchorTxHash: transfer.AnchorTxHash,
+		Outpoint:     output.Anchor.Outpoint,
+		AssetID:      assetID,
+		ScriptKey:    output.ScriptKey,
+		Amount:       amount,
+		PendingSince: since.UTC(),
+	}
+}
+
+// transferTime parses tapd's transfer timestamp in unix seconds.
+func transferTime(timestamp string) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+func deliveryKey(outpoint, scriptKey string) string {
+	return outpoint + "/" + scriptKey
+}
@@ -1,29 +1,176 @@
 package wallet
 
 import (
+	"log"
+	"tajfi-server/auth"
 	"tajfi-server/config"
 	"tajfi-server/middleware"
+	"tajfi-server/wallet/batch"
+	"tajfi-server/wallet/contacts"
+	"tajfi-server/wallet/cosign"
+	"tajfi-server/wallet/feebump"
+	"tajfi-server/wallet/idempotency"
+	"tajfi-server/wallet/operatorfee"
+	"tajfi-server/wallet/policy"
+	"tajfi-server/wallet/proofs"
+	"tajfi-server/wallet/scriptkeys"
+	"tajfi-server/wallet/sessions"
 	"tajfi-server/wallet/tapd"
+	"time"
 
 	echo "github.com/labstack/echo/v4"
 )
 
 func RegisterWalletRoutes(e *echo.Echo, cfg *config.Config, tapdClient tapd.TapdClientInterface) {
+	keys, err := auth.LoadKeySet(cfg.JWTKeysDir, cfg.JWTSigningKeyID, cfg.JWTSecret)
+	if err != nil {
+		log.Fatal("Failed to load JWT keys:", err)
+	}
+	apiKeys, err := auth.LoadAPIKeyStore(cfg.APIKeysFile)
+	if err != nil {
+		log.Fatal("Failed to load API keys:", err)
+	}
+
+	// Public keys for other services to verify tajfi access tokens
+	e.GET("/.well-known/jwks.json", GetJWKS(keys))
+
 	api := e.Group("/api/v1")
 
-	// No authentication for /wallet/connect
-	api.POST("/wallet/connect", ConnectWallet)
+	challenges := auth.NewChallengeStore(cfg.ChallengeTTL, cfg.ChallengeMaxPending)
+	go challenges.RunPrune(time.Minute)
+	tokens := auth.NewTokenService(keys, cfg.AccessTokenTTL, cfg.RefreshTokenTTL)
+
+	// Anchor internal keys are LND's unless a MuSig2 mode is set
+	var cosigner *cosign.Cosigner
+	if cfg.MuSig2Mode != "" {
+		cosigner, err = newCosigner(cfg)
+		if err != nil {
+			log.Fatal("Failed to set up MuSig2 cosigning:", err)
+		}
+	}
+
+	sendSessions := sessions.NewStore(cfg.SendSessionTTL, cfg.SendSessionRetention)
+	sendSessions.OnExpire(CancelExpiredSend(tapdClient, sendSessions, cosigner, cfg))
+	sendSessions.OnFail(ReleaseFailedSend(tapdClient, cosigner, cfg))
+	go sendSessions.RunExpiry(time.Minute)
+	handoff := tapd.NewSigHandoff(cfg.TaprootSigsDir)
+	completions := idempotency.NewStore(cfg.IdempotencyKeyTTL)
+
+	feeSchedule, err := operatorfee.LoadSchedule(cfg.OperatorFeeScheduleFile)
+	if err != nil {
+		log.Fatal("Failed to load operator fee schedule:", err)
+	}
+	feeLedger, err := operatorfee.LoadLedger(cfg.OperatorFeeLedgerFile)
+	if err != nil {
+		log.Fatal("Failed to load operator fee ledger:", err)
+	}
+	policies, err := policy.LoadStore(cfg.PolicyFile)
+	if err != nil {
+		log.Fatal("Failed to load spending policies:", err)
+	}
+	contactBook, err := contacts.LoadStore(cfg.ContactsFile)
+	if err != nil {
+		log.Fatal("Failed to load contacts:", err)
+	}
+	scriptKeys, err := scriptkeys.LoadStore(cfg.ScriptKeysFile)
+	if err != nil {
+		log.Fatal("Failed to load script keys:", err)
+	}
+
+	proofWatcher := proofs.NewWatcher(tapdClient, proofs.Options{
+		TapdHost:      cfg.TapdHost,
+		TapdMacaroon:  cfg.TapdMacaroon,
+		StuckAfter:    cfg.ProofDeliveryStuckAfter,
+		Courier:       cfg.ProofCourierAddr,
+		AutoRedeliver: cfg.ProofRedeliveryAuto,
+		MaxAttempts:   cfg.ProofRedeliveryMaxAttempts,
+	})
+	go proofWatcher.Run(cfg.ProofDeliveryCheckInterval)
+
+	bumper := feebump.NewBumper(tapdClient, feebump.Options{
+		TapdHost:     cfg.TapdHost,
+		TapdMacaroon: cfg.TapdMacaroon,
+		LNDHost:      cfg.LNDHost,
+		LNDMacaroon:  cfg.LNDMacaroon,
+		StuckAfter:   cfg.FeeBumpStuckAfter,
+		Auto:         cfg.FeeBumpAuto,
+		MaxAttempts:  cfg.FeeBumpMaxAttempts,
+		MaxFeeRate:   cfg.MaxFeeRate,
+		Estimate: func() (uint64, error) {
+			rate, _, err := ResolveFeeRate(cfg, FeeOptions{})
+			return rate, err
+		},
+	})
+	go bumper.Run(cfg.FeeBumpCheckInterval)
+
+	// Batching is off unless an interval is set, completed sends are then
+	// anchored one transaction each
+	var anchorBatcher *batch.Batcher
+	if cfg.AnchorBatchInterval > 0 {
+		anchorBatcher = batch.NewBatcher(tapdClient, sendSessions, batch.Options{
+			TapdHost:     cfg.TapdHost,
+			TapdMacaroon: cfg.TapdMacaroon,
+			LNDHost:      cfg.LNDHost,
+			LNDMacaroon:  cfg.LNDMacaroon,
+			TargetConf:   cfg.DefaultTargetConf,
+			Interval:     cfg.AnchorBatchInterval,
+			MaxSize:      cfg.AnchorBatchMaxSize,
+		})
+		anchorBatcher.OnAnchored(func(s *sessions.Session) {
+			recordOperatorFees(feeLedger, s, s.AnchorTxHash)
+			recordSpends(policies, s)
+		})
+		go anchorBatcher.Run()
+	}
+
+	// No authentication for /wallet/challenge, /wallet/connect and /wallet/token/refresh
+	api.GET("/wallet/challenge", GetChallenge(challenges))
+	api.POST("/wallet/connect", ConnectWallet(challenges, tokens, policies))
+	api.POST("/wallet/token/refresh", RefreshToken(tokens))
 
 	// Use auth middleware
 	walletGroup := api.Group("/wallet")
-	walletGroup.Use(middleware.AuthMiddleware(cfg.JWTSecret))
-
-	walletGroup.GET("", GetWallet)
-	walletGroup.POST("/send/decode", DecodeAddress(tapdClient))
-	walletGroup.POST("/send/start", SendStart(tapdClient))
-	walletGroup.POST("/send/complete", SendComplete(tapdClient))
-	walletGroup.GET("/balances", GetBalances(tapdClient))
-	walletGroup.GET("/transfers", GetTransfers(tapdClient))
+	walletGroup.Use(middleware.AuthMiddleware(cfg, tokens, apiKeys, auth.NewNIP98EventCache(), policies))
+
+	// Routes an API key may reach, given the matching scope
+	walletGroup.GET("/balances", GetBalances(tapdClient, scriptKeys), middleware.RequireScope(auth.ScopeBalancesRead))
+	walletGroup.GET("/transfers", GetTransfers(tapdClient, proofWatcher, bumper, scriptKeys), middleware.RequireScope(auth.ScopeTransfersRead))
+	walletGroup.POST("/receive", ReceiveAsset(tapdClient, cosigner), middleware.RequireScope(auth.ScopeReceiveCreate)) // Generate an invoice to receive an asset
+
+	// Routes that always require the user's own signature
+	walletGroup.GET("", GetWallet, middleware.UserOnly)
+	walletGroup.POST("/logout", Logout(tokens), middleware.UserOnly)
+	walletGroup.POST("/send/decode", DecodeAddress(tapdClient), middleware.UserOnly)
+	walletGroup.POST("/send/start", SendStart(tapdClient, sendSessions, handoff, anchorBatcher, cosigner, feeSchedule, policies, contactBook, scriptKeys), middleware.UserOnly)
+	walletGroup.POST("/consolidate", Consolidate(tapdClient, sendSessions, handoff, anchorBatcher, cosigner, scriptKeys), middleware.UserOnly)
+	walletGroup.POST("/send/sweep", Sweep(tapdClient, sendSessions, handoff, anchorBatcher, cosigner, feeSchedule, policies, scriptKeys), middleware.UserOnly)
+	walletGroup.POST("/send/complete", SendComplete(tapdClient, sendSessions, handoff, completions, feeLedger, policies, anchorBatcher, cosigner), middleware.UserOnly)
+	walletGroup.GET("/send/:id", GetSendSession(sendSessions), middleware.UserOnly)
+	walletGroup.POST("/send/:id/cancel", CancelSend(tapdClient, sendSessions, cosigner), middleware.UserOnly)
+	walletGroup.POST("/send/:id/cosign/nonces", RegisterCosignNonces(sendSessions, cosigner), middleware.UserOnly)
+	walletGroup.POST("/send/:id/cosign/partial-sigs", CompleteCosign(tapdClient, sendSessions, cosigner, feeLedger, policies), middleware.UserOnly)
+	walletGroup.GET("/contacts", ListContacts(contactBook), middleware.UserOnly)
+	walletGroup.POST("/contacts", CreateContact(contactBook), middleware.UserOnly)
+	walletGroup.GET("/contacts/:id", GetContact(contactBook), middleware.UserOnly)
+	walletGroup.PUT("/contacts/:id", UpdateContact(contactBook), middleware.UserOnly)
+	walletGroup.DELETE("/contacts/:id", DeleteContact(contactBook), middleware.UserOnly)
 	//walletGroup.GET("/transaction/:id", GetTransaction)
-	walletGroup.POST("/receive", ReceiveAsset(tapdClient)) // Generate an invoice to receive an asset
+
+	// Operator endpoints
+	adminGroup := api.Group("/admin")
+	adminGroup.Use(middleware.AdminMiddleware(cfg.AdminToken))
+
+	adminGroup.GET("/api-keys", ListAPIKeys(apiKeys))
+	adminGroup.POST("/api-keys", CreateAPIKey(apiKeys))
+	adminGroup.DELETE("/api-keys/:id", RevokeAPIKey(apiKeys))
+	adminGroup.GET("/fees", GetOperatorFees(feeLedger))
+	adminGroup.GET("/policies", ListPolicies(policies))
+	adminGroup.GET("/policies/:public_key", GetPolicy(policies))
+	adminGroup.PUT("/policies/:public_key", PutPolicy(policies))
+	adminGroup.DELETE("/policies/:public_key", DeletePolicy(policies))
+	adminGroup.GET("/proof-deliveries", ListStuckProofDeliveries(proofWatcher))
+	adminGroup.POST("/proof-deliveries/redeliver", RedeliverProof(proofWatcher))
+	adminGroup.GET("/anchor-batches", ListAnchorBatches(anchorBatcher))
+	adminGroup.GET("/fee-bumps", ListFeeBumps(bumper))
+	adminGroup.POST("/fee-bumps", BumpFee(bumper))
 }
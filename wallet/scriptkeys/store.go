@@ -0,0 +1,165 @@
+package scriptkeys
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+var ErrInvalidPubKey = errors.New("invalid x-only public key")
+
+// Key is a script key derived from a user's key: the user's key plus
+// Tweak times the generator. The user signs for it with their secret key
+// plus Tweak.
+type Key struct {
+	// ScriptKey is the key as tapd reports it, the x-only key prefixed by 02
+	ScriptKey string `json:"script_key"`
+	// PubKey is the x-only public key in hex of the user it was derived for
+	PubKey string `json:"pub_key"`
+	// Tweak is the 32-byte scalar in hex added to the user's key
+	Tweak     string    `json:"tweak"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// XOnly returns the derived key as an x-only public key in hex.
+func (k Key) XOnly() string {
+	return k.ScriptKey[2:]
+}
+
+// Store keeps the script keys derived for users in memory and, when path
+// is set, persists them to a JSON file. Losing it means assets at those
+// keys no longer show up as their owner's.
+type Store struct {
+	mu   sync.RWMutex
+	path string
+	keys map[string]*Key
+}
+
+// LoadStore opens the script key store at path, which may not exist yet. An
+// empty path keeps keys in memory only.
+func LoadStore(path string) (*Store, error) {
+	s := &Store{path: path, keys: make(map[string]*Key)}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored []Key
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i := range stored {
+		s.keys[stored[i].ScriptKey] = &stored[i]
+	}
+	return s, nil
+}
+
+// Derive records and returns a fresh script key for the x-only pubKey.
+func (s *Store) Derive(pubKey string) (*Key, error) {
+	raw, err := hex.DecodeString(pubKey)
+	if err != nil {
+		return nil, ErrInvalidPubKey
+	}
+	userKey, err := schnorr.ParsePubKey(raw)
+	if err != nil {
+		return nil, ErrInvalidPubKey
+	}
+
+	tweak, err := btcec.NewPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to draw a tweak: %w", err)
+	}
+
+	var user, tweakPoint, sum btcec.JacobianPoint
+	userKey.AsJacobian(&user)
+	btcec.ScalarBaseMultNonConst(&tweak.Key, &tweakPoint)
+	btcec.AddNonConst(&user, &tweakPoint, &sum)
+	sum.ToAffine()
+	derived := btcec.NewPublicKey(&sum.X, &sum.Y)
+
+	tweakBytes := tweak.Key.Bytes()
+	key := Key{
+		ScriptKey: "02" + hex.EncodeToString(schnorr.SerializePubKey(derived)),
+		PubKey:    pubKey,
+		Tweak:     hex.EncodeToString(tweakBytes[:]),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[key.ScriptKey] = &key
+	if err := s.saveLocked(); err != nil {
+		delete(s.keys, key.ScriptKey)
+		return nil, err
+	}
+	k := key
+	return &k, nil
+}
+
+// Get returns the derived key tapd reports as scriptKey.
+func (s *Store) Get(scriptKey string) (*Key, bool) {
+	if s == nil {
+		return nil, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[scriptKey]
+	if !ok {
+		return nil, false
+	}
+	k := *key
+	return &k, true
+}
+
+// Owns reports whether the x-only pubKey can spend assets at scriptKey, as
+// tapd reports it: the user's own key or one derived for them. A nil store
+// only knows users' own keys.
+func (s *Store) Owns(pubKey, scriptKey string) bool {
+	if scriptKey == "02"+pubKey {
+		return true
+	}
+	key, ok := s.Get(scriptKey)
+	return ok && key.PubKey == pubKey
+}
+
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	stored := make([]Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		stored = append(stored, *key)
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].CreatedAt.Before(stored[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write script keys: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
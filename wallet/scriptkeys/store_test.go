@@ -0,0 +1,102 @@
+package scriptkeys
+
+import (
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+func TestDerivedKeySignsWithTweakedSecret(t *testing.T) {
+	store, err := LoadStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := hex.EncodeToString(schnorr.SerializePubKey(user.PubKey()))
+
+	key, err := store.Derive(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// What a wallet does: lift its key to an even y, then add the tweak
+	secret := user.Key
+	if user.PubKey().SerializeCompressed()[0] == 0x03 {
+		secret.Negate()
+	}
+	tweak, err := hex.DecodeString(key.Tweak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var scalar btcec.ModNScalar
+	scalar.SetByteSlice(tweak)
+	secret.Add(&scalar)
+
+	digest := make([]byte, 32)
+	sig, err := schnorr.Sign(btcec.PrivKeyFromScalar(&secret), digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := hex.DecodeString(key.XOnly())
+	derived, err := schnorr.ParsePubKey(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sig.Verify(digest, derived) {
+		t.Fatal("signature with the tweaked secret does not verify against the derived key")
+	}
+}
+
+func TestOwns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script_keys.json")
+	store, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner := hex.EncodeToString(schnorr.SerializePubKey(mustKey(t)))
+	other := hex.EncodeToString(schnorr.SerializePubKey(mustKey(t)))
+
+	key, err := store.Derive(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Derived keys survive a restart
+	reloaded, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var none *Store
+	for name, tc := range map[string]struct {
+		store     *Store
+		pubKey    string
+		scriptKey string
+		want      bool
+	}{
+		"own key":          {reloaded, owner, "02" + owner, true},
+		"derived":          {reloaded, owner, key.ScriptKey, true},
+		"derived, other":   {reloaded, other, key.ScriptKey, false},
+		"unknown":          {reloaded, owner, "02" + other, false},
+		"nil store":        {none, owner, "02" + owner, true},
+		"nil store, other": {none, owner, key.ScriptKey, false},
+	} {
+		if got := tc.store.Owns(tc.pubKey, tc.scriptKey); got != tc.want {
+			t.Errorf("%s: Owns = %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func mustKey(t *testing.T) *btcec.PublicKey {
+	t.Helper()
+	priv, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv.PubKey()
+}
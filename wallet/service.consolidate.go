@@ -0,0 +1,34 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"tajfi-server/wallet/scriptkeys"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+)
+
+var ErrNothingToConsolidate = errors.New("at least two vUTXOs of the asset are needed to consolidate")
+
+// ConsolidationRecipient creates a fresh tap address of the caller's own
+// paying the full value of inputs, so a self-send to it merges them into a
+// single vUTXO. The address gets a new internal key and a fresh script key
+// derived from the caller's, which scriptKeys records as theirs.
+func ConsolidationRecipient(params ReceiveParams, tapdClient tapd.TapdClientInterface, scriptKeys *scriptkeys.Store, inputs []tapd.PrevId) (sessions.Recipient, error) {
+	if len(inputs) < 2 {
+		return sessions.Recipient{}, ErrNothingToConsolidate
+	}
+
+	key, err := scriptKeys.Derive(params.PubKey)
+	if err != nil {
+		return sessions.Recipient{}, fmt.Errorf("failed to derive a script key: %w", err)
+	}
+	params.ScriptKey = key.XOnly()
+
+	recipient, err := newAddressRecipient(params, tapdClient, TotalInputs(inputs))
+	if err != nil {
+		return sessions.Recipient{}, err
+	}
+	recipient.SelfSend = true
+	return recipient, nil
+}
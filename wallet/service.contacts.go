@@ -0,0 +1,53 @@
+package wallet
+
+import (
+	"errors"
+	"tajfi-server/wallet/contacts"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+)
+
+var (
+	ErrContactWithInvoices = errors.New("give either invoices or a contact_id, not both")
+	ErrContactNeedsAmount  = errors.New("sending to a contact requires an asset_id and an amount")
+)
+
+// ContactRecipients resolves a send of amount of params.AssetID to one of
+// pubKey's saved contacts into its recipient and the vUTXOs that may fund
+// it.
+func ContactRecipients(params ReceiveParams, tapdClient tapd.TapdClientInterface, contactBook *contacts.Store, pubKey, contactID string, amount uint64) ([]sessions.Recipient, AssetFilter, error) {
+	if params.AssetID == "" || amount == 0 {
+		return nil, AssetFilter{}, ErrContactNeedsAmount
+	}
+
+	contact, err := contactBook.Get(pubKey, contactID)
+	if err != nil {
+		return nil, AssetFilter{}, err
+	}
+
+	recipient, err := ContactRecipient(params, tapdClient, contact, amount)
+	if err != nil {
+		return nil, AssetFilter{}, err
+	}
+	return []sessions.Recipient{recipient}, AssetFilter{AssetID: params.AssetID, GroupKey: params.GroupKey}, nil
+}
+
+// ContactRecipient mints a fresh tap address for a saved contact paying
+// amount of params.AssetID.
+func ContactRecipient(params ReceiveParams, tapdClient tapd.TapdClientInterface, contact *contacts.Contact, amount uint64) (sessions.Recipient, error) {
+	dest := SweepDestination{ScriptKey: contact.ScriptKey, InternalKey: contact.InternalKey}
+	if contact.Npub != "" {
+		pubKey, err := contact.PubKey()
+		if err != nil {
+			return sessions.Recipient{}, err
+		}
+		dest = SweepDestination{PubKey: pubKey}
+	}
+
+	recipient, err := DestinationRecipient(params, tapdClient, dest, amount)
+	if err != nil {
+		return sessions.Recipient{}, err
+	}
+	recipient.ContactID = contact.ID
+	return recipient, nil
+}
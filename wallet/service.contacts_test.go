@@ -0,0 +1,33 @@
+package wallet
+
+import (
+	"tajfi-server/wallet/contacts"
+	"testing"
+)
+
+func TestContactRecipientsCarryGroupKey(t *testing.T) {
+	contactBook, err := contacts.LoadStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	contact, err := contactBook.Create(testPubKey, contacts.Contact{
+		Label:       "cold",
+		ScriptKey:   testPubKey,
+		InternalKey: "02" + testPubKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := ReceiveParams{AssetID: "tr1", GroupKey: AssetFilterFor(trancheUtxos(), "tr1").GroupKey, DryRun: true}
+	recipients, filter, err := ContactRecipients(params, nil, contactBook, testPubKey, contact.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter != (AssetFilter{AssetID: "tr1", GroupKey: "gk"}) {
+		t.Fatalf("filter = %+v, want tr1 in group gk", filter)
+	}
+	if len(recipients) != 1 || recipients[0].GroupKey != "gk" || recipients[0].ContactID != contact.ID {
+		t.Fatalf("recipients = %+v, want the contact paid in group gk", recipients)
+	}
+}
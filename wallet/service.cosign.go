@@ -0,0 +1,139 @@
+package wallet
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"tajfi-server/config"
+	"tajfi-server/wallet/cosign"
+	"tajfi-server/wallet/lnd"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+	"time"
+)
+
+// newCosigner sets up MuSig2 anchor keys for cfg.MuSig2Mode: "lnd" keeps
+// the server's keys in LND, "local" derives them in process from
+// cfg.MuSig2LocalSeed.
+func newCosigner(cfg *config.Config) (*cosign.Cosigner, error) {
+	var signer cosign.Signer
+	switch cfg.MuSig2Mode {
+	case "lnd":
+		signer = cosign.NewLNDSigner(cfg.LNDHost, cfg.LNDMacaroon)
+	case "local":
+		seed, err := hex.DecodeString(cfg.MuSig2LocalSeed)
+		if err != nil || len(seed) < 32 {
+			return nil, fmt.Errorf("MuSig2LocalSeed must be at least 32 bytes in hex")
+		}
+		signer = cosign.NewLocalSigner(seed)
+	default:
+		return nil, fmt.Errorf("unknown MuSig2Mode %q, use lnd or local", cfg.MuSig2Mode)
+	}
+
+	keys, err := cosign.LoadKeyStore(cfg.MuSig2KeysFile)
+	if err != nil {
+		return nil, err
+	}
+	return cosign.NewCosigner(signer, keys), nil
+}
+
+// spendsCosignedAnchor reports whether any of inputs is anchored in an
+// output with a MuSig2 internal key, which LND cannot sign for alone.
+func spendsCosignedAnchor(tapdClient tapd.TapdClientInterface, cfg *config.Config, cosigner *cosign.Cosigner, inputs []tapd.PrevId) (bool, error) {
+	utxos, err := tapdClient.GetUtxos(cfg.TapdHost, cfg.TapdMacaroon)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch utxos from tapd: %w", err)
+	}
+
+	spent := make(map[string]bool, len(inputs))
+	for _, input := range inputs {
+		spent[fmt.Sprintf("%s:%d", input.Outpoint.Txid, input.Outpoint.OutputIndex)] = true
+	}
+	for _, utxo := range utxos.ManagedUtxos {
+		if !spent[utxo.Outpoint] {
+			continue
+		}
+		internalKey, err := base64.StdEncoding.DecodeString(utxo.InternalKey)
+		if err != nil {
+			continue
+		}
+		if cosigner.Controls(hex.EncodeToString(internalKey)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// startCosign handles a signed session spending MuSig2 anchor outputs: it
+// has tapd commit the signed vPSBT to an anchor transaction without signing
+// it, starts the server's MuSig2 sessions for the inputs it shares with the
+// user and moves the session to awaiting_cosignature. The session's claim
+// is dropped so the user can send nonces and partial signatures. It returns
+// nil for sessions LND can anchor on its own.
+func startCosign(tapdClient tapd.TapdClientInterface, sendSessions *sessions.Store, cosigner *cosign.Cosigner, cfg *config.Config, session *sessions.Session, signedPSBT string) (*sessions.Session, error) {
+	cosigned, err := spendsCosignedAnchor(tapdClient, cfg, cosigner, session.Inputs)
+	if err != nil || !cosigned {
+		return nil, err
+	}
+
+	committed, err := tapdClient.CommitVirtualPSBTs(tapd.CommitVirtualPSBTsParams{
+		VirtualPSBTs:   []string{signedPSBT},
+		AnchorTemplate: tapd.AnchorTemplate(len(session.Recipients)+1, nil),
+		FeeRate:        session.FeeRate,
+		TargetConf:     cfg.DefaultTargetConf,
+		TapdHost:       cfg.TapdHost,
+		Macaroon:       cfg.TapdMacaroon,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	inputs, err := cosigner.Prepare(session.PubKey, committed.AnchorPSBT)
+	if err != nil {
+		releaseAnchorLeases(cfg, committed)
+		return nil, err
+	}
+
+	awaiting, err := sendSessions.Transition(session.ID, sessions.StatusAwaitingCosignature, func(s *sessions.Session) {
+		s.Cosign = &sessions.Cosign{
+			AnchorPSBT: committed.AnchorPSBT,
+			Inputs:     inputs,
+			Committed:  committed,
+		}
+		// The user gets a fresh TTL to produce the anchor signatures
+		s.ExpiresAt = time.Now().UTC().Add(cfg.SendSessionTTL)
+	})
+	if err != nil {
+		abandonCosign(cosigner, cfg, &sessions.Cosign{Inputs: inputs, Committed: committed})
+		return nil, err
+	}
+	sendSessions.Unclaim(session.ID)
+	return awaiting, nil
+}
+
+// abandonCosign undoes what startCosign set up for a send whose anchor
+// transaction will never be published: LND's leases on the outputs funding
+// it and the server's MuSig2 sessions. Failures are logged, leases expire
+// on their own.
+func abandonCosign(cosigner *cosign.Cosigner, cfg *config.Config, cosigning *sessions.Cosign) {
+	if cosigning == nil {
+		return
+	}
+	if cosigning.Committed != nil {
+		releaseAnchorLeases(cfg, cosigning.Committed)
+	}
+	if cosigner != nil {
+		if err := cosigner.Abandon(cosigning.Inputs); err != nil {
+			log.Printf("Failed to drop MuSig2 sessions: %v", err)
+		}
+	}
+}
+
+// releaseAnchorLeases releases LND's leases on the outputs tapd picked to
+// fund an anchor transaction.
+func releaseAnchorLeases(cfg *config.Config, committed *tapd.CommitVirtualPSBTsResponse) {
+	if err := lnd.ReleaseOutputs(cfg.LNDHost, cfg.LNDMacaroon, committed.LockedOutpoints()); err != nil {
+		log.Printf("Failed to release LND leases of anchor transaction: %v", err)
+	}
+}
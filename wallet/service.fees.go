@@ -0,0 +1,95 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"tajfi-server/config"
+	"tajfi-server/wallet/lnd"
+	"tajfi-server/wallet/tapd"
+)
+
+var (
+	ErrConflictingFeeOptions = errors.New("give either fee_rate or target_conf, not both")
+	ErrFeeRateOutOfBounds    = errors.New("fee rate is outside the allowed bounds")
+)
+
+// Rough virtual sizes of the pieces of an anchor transaction.
+const (
+	txOverheadVsize    = 11 // version, locktime, counts and segwit marker
+	taprootInputVsize  = 58 // key-path spend
+	taprootOutputVsize = 43
+)
+
+// EstimateAnchorFee previews what anchoring a send will cost on chain. The
+// fee rate is the client's, checked against the configured bounds, or else
+// LND's estimate for the confirmation target clamped to them.
+func EstimateAnchorFee(cfg *config.Config, opts FeeOptions, inputs []tapd.PrevId, recipients int) (*FeeEstimate, error) {
+	rate, targetConf, err := ResolveFeeRate(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	vsize := EstimateAnchorVsize(inputs, recipients)
+	return &FeeEstimate{
+		FeeRate:    rate,
+		TargetConf: targetConf,
+		Vsize:      vsize,
+		Fee:        vsize * rate,
+	}, nil
+}
+
+// ResolveFeeRate returns the anchor fee rate in sat/vB for opts, and the
+// confirmation target it was estimated for if any.
+func ResolveFeeRate(cfg *config.Config, opts FeeOptions) (uint64, int, error) {
+	if opts.FeeRate > 0 && opts.TargetConf > 0 {
+		return 0, 0, ErrConflictingFeeOptions
+	}
+
+	if opts.FeeRate > 0 {
+		if opts.FeeRate < cfg.MinFeeRate || (cfg.MaxFeeRate > 0 && opts.FeeRate > cfg.MaxFeeRate) {
+			return 0, 0, fmt.Errorf("%w: %d sat/vB is not within %d-%d", ErrFeeRateOutOfBounds, opts.FeeRate, cfg.MinFeeRate, cfg.MaxFeeRate)
+		}
+		return opts.FeeRate, 0, nil
+	}
+
+	targetConf := opts.TargetConf
+	if targetConf == 0 {
+		targetConf = cfg.DefaultTargetConf
+	}
+	estimate, err := lnd.EstimateFee(cfg.LNDHost, cfg.LNDMacaroon, targetConf)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to estimate fee: %w", err)
+	}
+	satPerKw, err := strconv.ParseUint(estimate.SatPerKw, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("LND returned an invalid fee rate: %w", err)
+	}
+
+	// 1 vbyte is 4 weight units, so 250 vbytes to the kw; round up
+	rate := (satPerKw + 249) / 250
+	if rate < cfg.MinFeeRate {
+		rate = cfg.MinFeeRate
+	}
+	if cfg.MaxFeeRate > 0 && rate > cfg.MaxFeeRate {
+		rate = cfg.MaxFeeRate
+	}
+
+	return rate, targetConf, nil
+}
+
+// EstimateAnchorVsize approximates the size of the anchor transaction for a
+// send spending inputs to the given number of recipients. Besides the anchor
+// outputs being spent it counts one BTC input from LND to pay the fee, one
+// anchor output per recipient plus one for the asset change, and a BTC change
+// output, all taproot.
+func EstimateAnchorVsize(inputs []tapd.PrevId, recipients int) uint64 {
+	anchors := make(map[tapd.Outpoint]bool, len(inputs))
+	for _, input := range inputs {
+		anchors[input.Outpoint] = true
+	}
+
+	numInputs := uint64(len(anchors) + 1)
+	numOutputs := uint64(recipients + 2)
+	return txOverheadVsize + numInputs*taprootInputVsize + numOutputs*taprootOutputVsize
+}
@@ -3,11 +3,17 @@ package wallet
 import (
 	"strconv"
 	"strings"
+	"tajfi-server/wallet/feebump"
+	"tajfi-server/wallet/proofs"
+	"tajfi-server/wallet/scriptkeys"
 	"tajfi-server/wallet/tapd"
 )
 
-func GetTransfersResponse(tapdTransfers tapd.AssetTransfersResponse, pubKey string) (transfers []Transfer) {
-	pubKey = "02" + pubKey // normalize the public key
+// GetTransfersResponse lists the transfers pubKey took part in. Proof
+// deliveries are only shown for the caller's own outputs, or for every
+// output of a transfer that spent nothing but the caller's vUTXOs: an
+// anchor transaction batching several users' sends holds outputs of others.
+func GetTransfersResponse(tapdTransfers tapd.AssetTransfersResponse, pubKey string, scriptKeys *scriptkeys.Store) (transfers []Transfer) {
 	for _, tapdTransfer := range tapdTransfers.Transfers {
 		var transfer Transfer
 		transfer.Timestamp = tapdTransfer.TransferTimestamp
@@ -24,22 +30,32 @@ func GetTransfersResponse(tapdTransfers tapd.AssetTransfersResponse, pubKey stri
 
 		var sentAmount, receivedAmount uint64
 
+		soleSender := len(tapdTransfer.Inputs) > 0
 		for _, input := range tapdTransfer.Inputs {
-			if input.ScriptKey == pubKey {
-				amount, err := strconv.ParseUint(input.Amount, 10, 64)
-				if err == nil {
-					sentAmount += amount
-				}
+			if !scriptKeys.Owns(pubKey, input.ScriptKey) {
+				soleSender = false
+				continue
+			}
+			amount, err := strconv.ParseUint(input.Amount, 10, 64)
+			if err == nil {
+				sentAmount += amount
 			}
 		}
 
 		for _, output := range tapdTransfer.Outputs {
-			if output.ScriptKey == pubKey {
+			owned := scriptKeys.Owns(pubKey, output.ScriptKey)
+			if owned {
 				amount, err := strconv.ParseUint(output.Amount, 10, 64)
 				if err == nil {
 					receivedAmount += amount
 				}
 			}
+			if !owned && !soleSender {
+				continue
+			}
+			if delivery, ok := proofDelivery(output); ok {
+				transfer.ProofDeliveries = append(transfer.ProofDeliveries, delivery)
+			}
 		}
 
 		if receivedAmount == 0 && sentAmount == 0 {
@@ -61,6 +77,65 @@ func GetTransfersResponse(tapdTransfers tapd.AssetTransfersResponse, pubKey stri
 	return transfers
 }
 
+// proofDelivery returns the proof delivery state of a transfer output, if
+// its proof has to be delivered to a courier at all.
+func proofDelivery(output tapd.TransferOutput) (ProofDelivery, bool) {
+	var status string
+	switch output.ProofDeliveryStatus {
+	case tapd.ProofDeliveryPending:
+		status = "pending"
+	case tapd.ProofDeliveryComplete:
+		status = "complete"
+	default:
+		return ProofDelivery{}, false
+	}
+
+	amount, _ := strconv.ParseUint(output.Amount, 10, 64)
+	return ProofDelivery{
+		Outpoint:  output.Anchor.Outpoint,
+		ScriptKey: output.ScriptKey,
+		Amount:    amount,
+		Status:    status,
+	}, true
+}
+
+// markStuckDeliveries flags the proof deliveries of transfers the watcher
+// considers stuck.
+func markStuckDeliveries(transfers []Transfer, watcher *proofs.Watcher) {
+	for i := range transfers {
+		for j, delivery := range transfers[i].ProofDeliveries {
+			if delivery.Status == "pending" && watcher.IsStuck(delivery.Outpoint, delivery.ScriptKey) {
+				transfers[i].ProofDeliveries[j].Stuck = true
+			}
+		}
+	}
+}
+
+// markFeeBumps adds the fee bumping state of their anchor transaction to
+// transfers that are stuck or were bumped.
+func markFeeBumps(transfers []Transfer, bumper *feebump.Bumper) {
+	for i := range transfers {
+		anchor, ok := bumper.Anchor(transfers[i].Txid)
+		if !ok {
+			continue
+		}
+
+		feeBump := &FeeBump{Stuck: anchor.Stuck}
+		for _, bump := range anchor.Bumps {
+			if bump.Error == "" {
+				feeBump.Bumps++
+			}
+		}
+		if last := anchor.LastBump(); last != nil {
+			bumpedAt := last.BumpedAt
+			feeBump.FeeRate = last.FeeRate
+			feeBump.Outpoint = last.Outpoint
+			feeBump.BumpedAt = &bumpedAt
+		}
+		transfers[i].FeeBump = feeBump
+	}
+}
+
 func UpdateBalancesWithUnconfirmed(
 	balances *tapd.WalletBalancesResponse,
 	transfers []Transfer,
@@ -105,6 +180,36 @@ func UpdateBalancesWithUnconfirmed(
 	}
 }
 
+// AggregateGroupBalances sums the balances of grouped assets per group key,
+// so every tranche of a re-issued asset counts towards one balance.
+func AggregateGroupBalances(balances *tapd.WalletBalancesResponse) {
+	for _, balance := range balances.AssetBalances {
+		if balance.GroupKey == "" {
+			continue
+		}
+		if balances.AssetGroupBalances == nil {
+			balances.AssetGroupBalances = make(map[string]tapd.AssetGroupBalance)
+		}
+
+		// Group keys are hex, which tapd may not always print in one case
+		groupKey := strings.ToLower(balance.GroupKey)
+		group := balances.AssetGroupBalances[groupKey]
+		group.GroupKey = groupKey
+
+		confirmed, _ := strconv.Atoi(balance.Balance)
+		existingConfirmed, _ := strconv.Atoi(group.Balance)
+		group.Balance = strconv.Itoa(existingConfirmed + confirmed)
+
+		if balance.UnconfirmedBalance != "" {
+			unconfirmed, _ := strconv.Atoi(balance.UnconfirmedBalance)
+			existingUnconfirmed, _ := strconv.Atoi(group.UnconfirmedBalance)
+			group.UnconfirmedBalance = strconv.Itoa(existingUnconfirmed + unconfirmed)
+		}
+
+		balances.AssetGroupBalances[groupKey] = group
+	}
+}
+
 func GenerateNewAddress() string {
 	// Logic to generate a Taproot address
 	return "bc1qxyz..."
@@ -0,0 +1,74 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"tajfi-server/wallet/operatorfee"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+	"time"
+)
+
+var ErrFeeExceedsBalance = errors.New("the balance does not cover the operator fee")
+
+// OperatorFeeRecipient creates a tap address of the operator's own tapd
+// wallet for fee units of assetID, to be paid as an extra output of a send.
+func OperatorFeeRecipient(tapdClient tapd.TapdClientInterface, tapdHost, macaroon, assetID string, fee uint64) (sessions.Recipient, error) {
+	address, err := tapdClient.CallNewAddress(tapdHost, macaroon, tapd.NewAddressPayload{
+		AssetID: assetID,
+		Amt:     int(fee),
+	})
+	if err != nil {
+		return sessions.Recipient{}, fmt.Errorf("failed to create operator fee address: %w", err)
+	}
+	encoded, ok := address["encoded"].(string)
+	if !ok {
+		return sessions.Recipient{}, fmt.Errorf("tapd returned an address without an encoding")
+	}
+
+	recipient := OperatorFeePlaceholder(assetID, fee)
+	recipient.Address = encoded
+	return recipient, nil
+}
+
+// OperatorFeePlaceholder is the operator fee output of a dry run, which
+// has no address minted for it.
+func OperatorFeePlaceholder(assetID string, fee uint64) sessions.Recipient {
+	return sessions.Recipient{
+		AssetID:     assetID,
+		Amount:      fee,
+		OperatorFee: true,
+	}
+}
+
+// OperatorFee returns the operator fee paid by recipients.
+func OperatorFee(recipients []sessions.Recipient) (fee uint64) {
+	for _, recipient := range recipients {
+		if recipient.OperatorFee {
+			fee += recipient.Amount
+		}
+	}
+	return fee
+}
+
+// recordOperatorFees adds the operator fees paid by an anchored session to
+// the ledger.
+func recordOperatorFees(ledger *operatorfee.Ledger, session *sessions.Session, anchorTxHash string) {
+	for _, recipient := range session.Recipients {
+		if !recipient.OperatorFee {
+			continue
+		}
+
+		err := ledger.Record(operatorfee.Entry{
+			SessionID:    session.ID,
+			AssetID:      recipient.AssetID,
+			Amount:       recipient.Amount,
+			AnchorTxHash: anchorTxHash,
+			CollectedAt:  time.Now().UTC(),
+		})
+		if err != nil {
+			log.Printf("Failed to record operator fee of send session %s: %v", session.ID, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"tajfi-server/config"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+)
+
+// PlanSend works out what a send would do without opening a signing session.
+// It selects inputs, prices the anchor and has tapd fund the vPSBT to prove it
+// can, then releases the leases tapd took on the inputs. A balance that does
+// not cover the recipients is reported in the plan rather than as an error.
+func PlanSend(tapdClient tapd.TapdClientInterface, cfg *config.Config, assetFilter AssetFilter, recipients []sessions.Recipient, available []tapd.PrevId, selector CoinSelector, feeOpts FeeOptions) (*SendPlan, error) {
+	plan := &SendPlan{
+		AssetFilter:  assetFilter,
+		Inputs:       []PlanInput{},
+		Outputs:      recipients,
+		TotalOutputs: TotalAmount(recipients),
+		OperatorFee:  OperatorFee(recipients),
+		Available:    TotalInputs(available),
+	}
+
+	inputs, err := selector.Select(available, plan.TotalOutputs)
+	if errors.Is(err, ErrInsufficientBalance) {
+		return plan, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Sufficient = true
+	plan.Inputs = planInputs(inputs)
+	plan.TotalInputs = TotalInputs(inputs)
+	plan.Change = plan.TotalInputs - plan.TotalOutputs
+
+	plan.FeeEstimate, err = EstimateAnchorFee(cfg, feeOpts, inputs, len(recipients))
+	switch {
+	case errors.Is(err, ErrConflictingFeeOptions), errors.Is(err, ErrFeeRateOutOfBounds):
+		return nil, err
+	case err != nil:
+		log.Printf("Planning send without a fee estimate: %v", err)
+	}
+
+	// Outputs paying a contact or the operator get no address minted for a
+	// dry run, so tapd can only check the funding of the others
+	var addresses []string
+	for _, recipient := range recipients {
+		if recipient.Address != "" {
+			addresses = append(addresses, recipient.Address)
+		}
+	}
+	if len(addresses) == 0 {
+		return plan, nil
+	}
+
+	// Let tapd check it can fund the vPSBT, then hand the inputs straight back
+	funded, err := tapdClient.FundVirtualPSBT(cfg.TapdHost, cfg.TapdMacaroon, addresses, tapd.PrevIds{Inputs: inputs}, 0)
+	if err != nil {
+		return nil, fmt.Errorf("tapd could not fund the send: %w", err)
+	}
+	if err := ReleaseInputs(tapdClient, cfg.TapdHost, cfg.TapdMacaroon, inputs); err != nil {
+		log.Printf("Failed to release leases after dry run: %v", err)
+	}
+
+	// tapd's change index only holds when it funded every output
+	if plan.Change > 0 && len(addresses) == len(recipients) {
+		plan.ChangeOutputIndex = &funded.ChangeOutputIndex
+	}
+
+	return plan, nil
+}
+
+// ReleaseInputs releases tapd's leases on the anchor outpoints of inputs. It
+// tries every outpoint and returns the first error.
+func ReleaseInputs(tapdClient tapd.TapdClientInterface, tapdHost, macaroon string, inputs []tapd.PrevId) error {
+	var firstErr error
+	released := make(map[tapd.Outpoint]bool, len(inputs))
+	for _, input := range inputs {
+		if released[input.Outpoint] {
+			continue
+		}
+		released[input.Outpoint] = true
+
+		if err := tapdClient.RemoveUTXOLease(tapdHost, macaroon, input.Outpoint); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to release %s:%d: %w", input.Outpoint.Txid, input.Outpoint.OutputIndex, err)
+		}
+	}
+	return firstErr
+}
+
+// planInputs describes the selected inputs of a plan.
+func planInputs(inputs []tapd.PrevId) []PlanInput {
+	planned := make([]PlanInput, len(inputs))
+	for i, input := range inputs {
+		planned[i] = PlanInput{
+			Outpoint:    fmt.Sprintf("%s:%d", input.Outpoint.Txid, input.Outpoint.OutputIndex),
+			Amount:      uint64(input.Amount),
+			BlockHeight: input.BlockHeight,
+		}
+	}
+	return planned
+}
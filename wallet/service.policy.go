@@ -0,0 +1,58 @@
+package wallet
+
+import (
+	"log"
+	"strings"
+	"tajfi-server/wallet/policy"
+	"tajfi-server/wallet/sessions"
+	"time"
+)
+
+// PolicyTransfers returns the outputs of a send by pubKey that spending
+// policies apply to. The operator fee and outputs paying the sender back,
+// such as consolidations, are left out.
+func PolicyTransfers(pubKey string, recipients []sessions.Recipient) []policy.Transfer {
+	var transfers []policy.Transfer
+	for _, recipient := range recipients {
+		if recipient.OperatorFee || recipient.SelfSend || isOwnScriptKey(recipient.ScriptKey, pubKey) {
+			continue
+		}
+		transfers = append(transfers, policy.Transfer{
+			AssetID:   recipient.AssetID,
+			GroupKey:  recipient.GroupKey,
+			Amount:    recipient.Amount,
+			Address:   recipient.Address,
+			ScriptKey: recipient.ScriptKey,
+		})
+	}
+	return transfers
+}
+
+// CheckPolicy checks a send by pubKey paying recipients against the user's
+// spending policy, counting the sends they have not completed yet towards
+// their limits. It returns a *policy.Violation if the send is not allowed.
+func CheckPolicy(policies *policy.Store, sendSessions *sessions.Store, pubKey string, recipients []sessions.Recipient) error {
+	var pending []policy.Transfer
+	for _, session := range sendSessions.Pending(pubKey) {
+		pending = append(pending, PolicyTransfers(pubKey, session.Recipients)...)
+	}
+
+	return policies.Check(pubKey, PolicyTransfers(pubKey, recipients), pending, time.Now())
+}
+
+// recordSpends adds what an anchored session sent to its owner's spends.
+func recordSpends(policies *policy.Store, session *sessions.Session) {
+	transfers := PolicyTransfers(session.PubKey, session.Recipients)
+	if err := policies.Record(session.PubKey, session.ID, transfers, time.Now()); err != nil {
+		log.Printf("Failed to record spends of send session %s: %v", session.ID, err)
+	}
+}
+
+// isOwnScriptKey reports whether scriptKey, compressed or x-only, is the
+// user's x-only pubKey.
+func isOwnScriptKey(scriptKey, pubKey string) bool {
+	if len(scriptKey) == 66 {
+		scriptKey = scriptKey[2:]
+	}
+	return scriptKey != "" && strings.EqualFold(scriptKey, pubKey)
+}
@@ -9,17 +9,33 @@ import (
 
 // Receive initializes the generate invoice process.
 func Receive(params ReceiveParams, tapdClient tapd.TapdClientInterface) (map[string]interface{}, error) {
-	// Step 1: Call LND to get the internal key
-	log.Println("Getting internal key with params", params)
-	internalKey, err := lnd.GetInternalKey(params.LNDHost, params.LNMacaroon)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get internal key: %w", err)
+	// Step 1: Call LND to get the internal key, unless the caller brought one
+	// or it is a MuSig2 key
+	internalKey := params.InternalKey
+	if internalKey == nil && params.Cosigner != nil {
+		var err error
+		internalKey, err = params.Cosigner.NewInternalKey(params.PubKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get MuSig2 internal key: %w", err)
+		}
+	}
+	if internalKey == nil {
+		log.Println("Getting internal key with params", params)
+		var err error
+		internalKey, err = lnd.GetInternalKey(params.LNDHost, params.LNMacaroon)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get internal key: %w", err)
+		}
 	}
 
 	log.Println("Got internal key", internalKey)
 
-	// compress pubkey
-	rawKeyBytes, err := CompressPubKey(params.PubKey)
+	// compress the script key, the user's own unless another one was given
+	scriptKey := params.PubKey
+	if params.ScriptKey != "" {
+		scriptKey = params.ScriptKey
+	}
+	rawKeyBytes, err := CompressPubKey(scriptKey)
 	if err != nil {
 		log.Println(err)
 		return nil, fmt.Errorf("failed to compress pubkey: %w", err)
@@ -30,12 +46,12 @@ func Receive(params ReceiveParams, tapdClient tapd.TapdClientInterface) (map[str
 		AssetID: params.AssetID,
 		Amt:     params.Amount,
 		ScriptKey: map[string]interface{}{
-			"pub_key": params.PubKey,
+			"pub_key": scriptKey,
 			"key_desc": map[string]interface{}{
 				"raw_key_bytes": rawKeyBytes,
 			},
 		},
-		InternalKey: *internalKey,
+		InternalKey: internalKey,
 	}
 
 	log.Println("Prepared Tapd payload", payload)
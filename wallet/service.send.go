@@ -0,0 +1,117 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+)
+
+var (
+	ErrNoRecipients        = errors.New("at least one invoice is required")
+	ErrDuplicateRecipient  = errors.New("the same invoice was given more than once")
+	ErrMixedAssets         = errors.New("all invoices must be for the same asset ID")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+)
+
+// AssetFilter selects the vUTXOs a send may spend: those of AssetID. A vPSBT
+// carries a single asset ID, so tranches of the same group are never mixed.
+// GroupKey, when set, is what the send's fee and spending limits are looked
+// up by.
+type AssetFilter struct {
+	AssetID  string `json:"asset_id"`
+	GroupKey string `json:"group_key,omitempty"`
+}
+
+// Matches reports whether asset may fund a send filtered by f.
+func (f AssetFilter) Matches(asset tapd.Asset) bool {
+	return strings.EqualFold(asset.AssetGenesis.AssetID, f.AssetID)
+}
+
+// AssetFilterFor returns the filter for the vUTXOs of assetID, with the key
+// of its group if one of utxos shows it has one.
+func AssetFilterFor(utxos *tapd.GetUtxosResponse, assetID string) AssetFilter {
+	for _, utxo := range utxos.ManagedUtxos {
+		for _, asset := range utxo.Assets {
+			if strings.EqualFold(asset.AssetGenesis.AssetID, assetID) && asset.GroupKey() != "" {
+				return AssetFilter{AssetID: assetID, GroupKey: asset.GroupKey()}
+			}
+		}
+	}
+	return AssetFilter{AssetID: assetID}
+}
+
+// DecodeRecipients decodes every invoice of a send and checks they all pay
+// out the same asset ID. It returns the recipients and the filter for the
+// vUTXOs that may fund them.
+func DecodeRecipients(tapdClient tapd.TapdClientInterface, tapdHost, macaroon string, invoices []string) ([]sessions.Recipient, AssetFilter, error) {
+	if len(invoices) == 0 {
+		return nil, AssetFilter{}, ErrNoRecipients
+	}
+
+	var (
+		filter     AssetFilter
+		recipients = make([]sessions.Recipient, 0, len(invoices))
+		seen       = make(map[string]bool, len(invoices))
+	)
+	for i, invoice := range invoices {
+		if seen[invoice] {
+			return nil, AssetFilter{}, ErrDuplicateRecipient
+		}
+		seen[invoice] = true
+
+		decoded, err := tapdClient.DecodeAddr(tapdHost, macaroon, invoice)
+		if err != nil {
+			return nil, AssetFilter{}, fmt.Errorf("failed to decode invoice %d: %w", i, err)
+		}
+		amount, err := strconv.ParseUint(decoded.Amount, 10, 64)
+		if err != nil {
+			return nil, AssetFilter{}, fmt.Errorf("invoice %d has an invalid amount: %w", i, err)
+		}
+
+		switch {
+		case i == 0:
+			filter = AssetFilter{AssetID: decoded.AssetID, GroupKey: decoded.GroupKey}
+		case decoded.AssetID != filter.AssetID:
+			// Even another tranche of the group needs a vPSBT of its own
+			return nil, AssetFilter{}, ErrMixedAssets
+		}
+
+		recipients = append(recipients, sessions.Recipient{
+			Address:   invoice,
+			AssetID:   decoded.AssetID,
+			GroupKey:  decoded.GroupKey,
+			Amount:    amount,
+			ScriptKey: decoded.ScriptKey,
+		})
+	}
+
+	return recipients, filter, nil
+}
+
+// TotalAmount sums what the recipients of a send are paid.
+func TotalAmount(recipients []sessions.Recipient) (total uint64) {
+	for _, recipient := range recipients {
+		total += recipient.Amount
+	}
+	return total
+}
+
+// TotalInputs sums the amounts of the given inputs.
+func TotalInputs(inputs []tapd.PrevId) (total uint64) {
+	for _, input := range inputs {
+		total += uint64(input.Amount)
+	}
+	return total
+}
+
+// recipientAddresses lists the tap addresses of recipients in order.
+func recipientAddresses(recipients []sessions.Recipient) []string {
+	addresses := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		addresses[i] = recipient.Address
+	}
+	return addresses
+}
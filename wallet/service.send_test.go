@@ -0,0 +1,63 @@
+package wallet
+
+import (
+	"errors"
+	mocks "tajfi-server/mocks/wallet/tapd"
+	"tajfi-server/wallet/tapd"
+	"testing"
+)
+
+const testPubKey = "0b8f3312058cf68ee9d04a0ca7f952abc05ac718484bff467253d6ae8ed3a427"
+
+// trancheUtxos holds the caller's vUTXOs of two tranches of group gk.
+func trancheUtxos() *tapd.GetUtxosResponse {
+	tranche := func(assetID, amount string) tapd.Asset {
+		return tapd.Asset{
+			AssetGenesis: tapd.AssetGenesis{AssetID: assetID},
+			Amount:       amount,
+			ScriptKey:    "02" + testPubKey,
+			AssetGroup:   &tapd.AssetGroup{TweakedGroupKey: "gk"},
+		}
+	}
+	return &tapd.GetUtxosResponse{ManagedUtxos: map[string]tapd.ManagedUtxo{
+		"aa:0": {Outpoint: "aa:0", Assets: []tapd.Asset{tranche("tr1", "20")}},
+		"bb:1": {Outpoint: "bb:1", Assets: []tapd.Asset{tranche("tr2", "25"), tranche("tr1", "5")}},
+	}}
+}
+
+func TestSendSpendsOnlyTheAddressTranche(t *testing.T) {
+	tapdClient := mocks.NewTapdClientInterface(t)
+	tapdClient.On("DecodeAddr", "host", "mac", "tr1-address").
+		Return(&tapd.DecodeAddrResponse{AssetID: "tr1", GroupKey: "gk", Amount: "10"}, nil)
+
+	_, filter, err := DecodeRecipients(tapdClient, "host", "mac", []string{"tr1-address"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.GroupKey != "gk" {
+		t.Fatalf("filter = %+v, want the group key kept for fees and limits", filter)
+	}
+
+	inputs := FilterOwnedUtxos(trancheUtxos(), testPubKey, filter, nil).Inputs
+	if len(inputs) != 2 {
+		t.Fatalf("got %d inputs, want the 2 vUTXOs of tr1", len(inputs))
+	}
+	for _, input := range inputs {
+		if input.AssetId != "tr1" {
+			t.Fatalf("input %+v is not of the address's asset ID", input)
+		}
+	}
+}
+
+func TestSendRefusesInvoicesOfTwoTranches(t *testing.T) {
+	tapdClient := mocks.NewTapdClientInterface(t)
+	tapdClient.On("DecodeAddr", "host", "mac", "tr1-address").
+		Return(&tapd.DecodeAddrResponse{AssetID: "tr1", GroupKey: "gk", Amount: "10"}, nil)
+	tapdClient.On("DecodeAddr", "host", "mac", "tr2-address").
+		Return(&tapd.DecodeAddrResponse{AssetID: "tr2", GroupKey: "gk", Amount: "10"}, nil)
+
+	_, _, err := DecodeRecipients(tapdClient, "host", "mac", []string{"tr1-address", "tr2-address"})
+	if !errors.Is(err, ErrMixedAssets) {
+		t.Fatalf("err = %v, want ErrMixedAssets", err)
+	}
+}
@@ -0,0 +1,128 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"tajfi-server/wallet/lnd"
+	"tajfi-server/wallet/operatorfee"
+	"tajfi-server/wallet/sessions"
+	"tajfi-server/wallet/tapd"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+var (
+	ErrNothingToSweep     = errors.New("no vUTXOs of the asset to sweep")
+	ErrInvalidSweepTarget = errors.New("give either destination_pubkey, or both script_key and internal_key")
+	ErrInvalidInternalKey = errors.New("internal_key must be a 33-byte compressed public key in hex")
+)
+
+// SweepDestination is where a sweep sends the caller's whole balance: either
+// a user identified by their public key, who gets a fresh address the same
+// way /wallet/receive makes one, or an explicit script key and internal key.
+type SweepDestination struct {
+	PubKey      string `json:"destination_pubkey"`
+	ScriptKey   string `json:"script_key"`
+	InternalKey string `json:"internal_key"`
+}
+
+// SweepFee returns the operator fee on sweeping a balance of total. It is
+// charged on the amount the destination receives, like the fee of a send,
+// so it is the fee on the largest amount that leaves room for it. A unit
+// left over by rounding goes to the destination.
+func SweepFee(feeSchedule *operatorfee.Schedule, filter AssetFilter, total uint64) uint64 {
+	feeOn := func(amount uint64) uint64 {
+		return feeSchedule.FeeFor(filter.AssetID, filter.GroupKey, amount)
+	}
+
+	// amount+feeOn(amount) grows with amount, find the largest that fits
+	low, high := uint64(0), total
+	for low < high {
+		mid := high - (high-low)/2
+		if feeOn(mid) <= total-mid {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	if low == 0 {
+		// Nothing fits beside the fee, SweepRecipient rejects the sweep
+		return feeOn(total)
+	}
+	return feeOn(low)
+}
+
+// SweepRecipient creates a tap address for dest paying the full value of
+// inputs less the operator fee, so spending all of them to it and the fee
+// leaves no change.
+func SweepRecipient(params ReceiveParams, tapdClient tapd.TapdClientInterface, dest SweepDestination, inputs []tapd.PrevId, fee uint64) (sessions.Recipient, error) {
+	if len(inputs) == 0 {
+		return sessions.Recipient{}, ErrNothingToSweep
+	}
+	total := TotalInputs(inputs)
+	if fee >= total {
+		return sessions.Recipient{}, ErrFeeExceedsBalance
+	}
+
+	return DestinationRecipient(params, tapdClient, dest, total-fee)
+}
+
+// DestinationRecipient creates a fresh tap address for dest paying amount.
+func DestinationRecipient(params ReceiveParams, tapdClient tapd.TapdClientInterface, dest SweepDestination, amount uint64) (sessions.Recipient, error) {
+	switch {
+	case dest.PubKey != "" && dest.ScriptKey == "" && dest.InternalKey == "":
+		params.PubKey = dest.PubKey
+		params.InternalKey = nil
+	case dest.PubKey == "" && dest.ScriptKey != "" && dest.InternalKey != "":
+		keyBytes, err := hex.DecodeString(dest.InternalKey)
+		if err != nil || len(keyBytes) != 33 {
+			return sessions.Recipient{}, ErrInvalidInternalKey
+		}
+		if _, err := btcec.ParsePubKey(keyBytes); err != nil {
+			return sessions.Recipient{}, ErrInvalidInternalKey
+		}
+		params.PubKey = dest.ScriptKey
+		params.InternalKey = &lnd.InternalKeyResponse{RawKeyBytes: dest.InternalKey}
+	default:
+		return sessions.Recipient{}, ErrInvalidSweepTarget
+	}
+
+	// Catch a bad key here rather than as an error from tapd
+	if _, err := CompressPubKey(params.PubKey); err != nil {
+		return sessions.Recipient{}, fmt.Errorf("%w: %v", ErrInvalidSweepTarget, err)
+	}
+
+	return newAddressRecipient(params, tapdClient, amount)
+}
+
+// newAddressRecipient creates a tap address for params.PubKey, or the
+// script key given in params, paying amount. For a dry run the recipient
+// is left without an address.
+func newAddressRecipient(params ReceiveParams, tapdClient tapd.TapdClientInterface, amount uint64) (sessions.Recipient, error) {
+	params.Amount = int(amount)
+	scriptKey := params.PubKey
+	if params.ScriptKey != "" {
+		scriptKey = params.ScriptKey
+	}
+	if params.DryRun {
+		return sessions.Recipient{AssetID: params.AssetID, GroupKey: params.GroupKey, Amount: amount, ScriptKey: scriptKey}, nil
+	}
+
+	address, err := Receive(params, tapdClient)
+	if err != nil {
+		return sessions.Recipient{}, err
+	}
+	encoded, ok := address["encoded"].(string)
+	if !ok {
+		return sessions.Recipient{}, fmt.Errorf("tapd returned an address without an encoding")
+	}
+
+	return sessions.Recipient{
+		Address:   encoded,
+		AssetID:   params.AssetID,
+		GroupKey:  params.GroupKey,
+		Amount:    amount,
+		ScriptKey: scriptKey,
+	}, nil
+}
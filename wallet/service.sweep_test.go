@@ -0,0 +1,29 @@
+package wallet
+
+import "testing"
+
+func TestSweepSpendsOneTranche(t *testing.T) {
+	utxos := trancheUtxos()
+	filter := AssetFilterFor(utxos, "tr2")
+	if filter.GroupKey != "gk" {
+		t.Fatalf("filter = %+v, want the group key kept for the fee", filter)
+	}
+
+	inputs := FilterOwnedUtxos(utxos, testPubKey, filter, nil).Inputs
+	if len(inputs) != 1 || inputs[0].AssetId != "tr2" || TotalInputs(inputs) != 25 {
+		t.Fatalf("inputs = %+v, want the one vUTXO of tr2", inputs)
+	}
+}
+
+func TestSweepRecipientCarriesGroupKey(t *testing.T) {
+	params := ReceiveParams{AssetID: "tr2", GroupKey: "gk", DryRun: true}
+	dest := SweepDestination{PubKey: testPubKey}
+
+	recipient, err := DestinationRecipient(params, nil, dest, 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient.GroupKey != "gk" {
+		t.Fatalf("recipient = %+v, want the group key of the swept asset", recipient)
+	}
+}
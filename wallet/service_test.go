@@ -0,0 +1,55 @@
+package wallet
+
+import (
+	"tajfi-server/wallet/tapd"
+	"testing"
+)
+
+const otherPubKey = "4902363d8b9531bd4c8fe58f24dfd2b8a2f03816a3d2ca3a64eedfa8d34b493d"
+
+func transferOutput(outpoint, scriptKey, amount string) tapd.TransferOutput {
+	return tapd.TransferOutput{
+		Anchor:              tapd.Anchor{Outpoint: outpoint},
+		ScriptKey:           scriptKey,
+		Amount:              amount,
+		ProofDeliveryStatus: tapd.ProofDeliveryPending,
+	}
+}
+
+func TestTransfersHideForeignProofDeliveries(t *testing.T) {
+	transfers := tapd.AssetTransfersResponse{Transfers: []tapd.AssetTransferResponse{
+		// An anchor batching the caller's send with another user's
+		{
+			Inputs: []tapd.TransferInput{
+				{AssetID: "asset", ScriptKey: "02" + testPubKey, Amount: "50"},
+				{AssetID: "asset", ScriptKey: "02" + otherPubKey, Amount: "40"},
+			},
+			Outputs: []tapd.TransferOutput{
+				transferOutput("tx:0", "02"+testPubKey, "30"),
+				transferOutput("tx:1", "02"+otherPubKey, "25"),
+				transferOutput("tx:2", "02aaaa", "35"),
+			},
+		},
+		// A send of the caller's alone
+		{
+			Inputs: []tapd.TransferInput{{AssetID: "asset", ScriptKey: "02" + testPubKey, Amount: "30"}},
+			Outputs: []tapd.TransferOutput{
+				transferOutput("ty:0", "02"+testPubKey, "10"),
+				transferOutput("ty:1", "02bbbb", "20"),
+			},
+		},
+	}}
+
+	got := GetTransfersResponse(transfers, testPubKey, nil)
+	if len(got) != 2 {
+		t.Fatalf("got %d transfers, want 2", len(got))
+	}
+
+	batched := got[0].ProofDeliveries
+	if len(batched) != 1 || batched[0].Outpoint != "tx:0" {
+		t.Fatalf("batched transfer deliveries = %+v, want only the caller's output", batched)
+	}
+	if alone := got[1].ProofDeliveries; len(alone) != 2 {
+		t.Fatalf("sole sender deliveries = %+v, want every output", alone)
+	}
+}
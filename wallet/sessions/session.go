@@ -0,0 +1,158 @@
+package sessions
+
+import (
+	"tajfi-server/wallet/tapd"
+	"time"
+)
+
+// Status is the state of a send session.
+//
+//	funded -> awaiting_signature -> signed -> anchored
+//
+// In batching mode signed sessions wait in the anchor queue before being
+// anchored together with others:
+//
+//	signed -> queued -> anchored
+//
+// Sends spending MuSig2 anchor outputs wait for the user's share of the
+// anchor transaction's signatures once their vPSBT is signed:
+//
+//	signed -> awaiting_cosignature -> anchored
+//
+// Any non-final state can move to failed, and states waiting on the user
+// move to expired once the session's TTL has passed. Sessions waiting on the
+// user, or expired, are cancelled once their leased inputs are released.
+type Status string
+
+const (
+	StatusFunded            Status = "funded"
+	StatusAwaitingSignature Status = "awaiting_signature"
+	StatusSigned            Status = "signed"
+	StatusQueued            Status = "queued"
+	// StatusAwaitingCosignature waits on the user's MuSig2 nonces and
+	// partial signatures for the anchor transaction
+	StatusAwaitingCosignature Status = "awaiting_cosignature"
+	StatusAnchored            Status = "anchored"
+	StatusFailed              Status = "failed"
+	StatusExpired             Status = "expired"
+	StatusCancelled           Status = "cancelled"
+)
+
+var allowedTransitions = map[Status][]Status{
+	StatusFunded:              {StatusAwaitingSignature, StatusFailed, StatusExpired, StatusCancelled},
+	StatusAwaitingSignature:   {StatusSigned, StatusFailed, StatusExpired, StatusCancelled},
+	StatusExpired:             {StatusCancelled},
+	StatusSigned:              {StatusQueued, StatusAwaitingCosignature, StatusAnchored, StatusFailed},
+	StatusQueued:              {StatusAnchored, StatusFailed},
+	StatusAwaitingCosignature: {StatusAnchored, StatusFailed, StatusExpired, StatusCancelled},
+}
+
+// Final reports whether no further transitions are possible.
+func (s Status) Final() bool {
+	return len(allowedTransitions[s]) == 0
+}
+
+func (s Status) canTransitionTo(next Status) bool {
+	for _, allowed := range allowedTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Session is the server side state of a send between /send/start and
+// /send/complete.
+type Session struct {
+	ID         string         `json:"id"`
+	PubKey     string         `json:"public_key"`
+	Status     Status         `json:"status"`
+	FundedPSBT string         `json:"funded_psbt"`
+	Recipients []Recipient    `json:"recipients"`
+	Inputs     []tapd.PrevId  `json:"inputs"`
+	Sighashes  []InputSighash `json:"sighashes,omitempty"`
+	FeeRate    uint64         `json:"fee_rate,omitempty"` // anchor fee rate in sat/vB, 0 leaves it to tapd
+	SignedPSBT string         `json:"signed_psbt,omitempty"`
+	// BatchID is the anchor batch the session's anchor outputs are
+	// reserved in
+	BatchID      string `json:"batch_id,omitempty"`
+	AnchorTxHash string `json:"anchor_tx_hash,omitempty"`
+	// Cosign is the anchor transaction awaiting the user's MuSig2 signatures
+	Cosign *Cosign `json:"cosign,omitempty"`
+	Error  string  `json:"error,omitempty"`
+	// CancelledBy is "user" or "expiry" once the session is cancelled
+	CancelledBy string    `json:"cancelled_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	Transfer *tapd.AssetTransferResponse `json:"transfer,omitempty"`
+
+	busy bool
+}
+
+// Recipient is one tap address paid by a send.
+type Recipient struct {
+	Address  string `json:"address"`
+	AssetID  string `json:"asset_id"`
+	GroupKey string `json:"group_key,omitempty"`
+	Amount   uint64 `json:"amount"`
+	// ScriptKey is the key the recipient receives the asset to, when known
+	ScriptKey string `json:"script_key,omitempty"`
+	// ContactID is the saved contact the address was minted for
+	ContactID string `json:"contact_id,omitempty"`
+	// OperatorFee marks the output paying the operator's fee on the send
+	OperatorFee bool `json:"operator_fee,omitempty"`
+	// SelfSend marks an output paying the sender back at a script key
+	// derived for them, such as a consolidation's
+	SelfSend bool `json:"self_send,omitempty"`
+}
+
+// InputSighash is the sighash the user must sign for one vPSBT input.
+type InputSighash struct {
+	InputIndex int    `json:"input_index"`
+	Outpoint   string `json:"outpoint"`
+	SighashHex string `json:"sighash_hex"`
+	// ScriptKey and KeyTweak are set for inputs at a script key derived
+	// from the user's: the x-only key to sign for and the tweak to add to
+	// the user's secret key to do so
+	ScriptKey string `json:"script_key,omitempty"`
+	KeyTweak  string `json:"key_tweak,omitempty"`
+}
+
+// Cosign is an anchor transaction tapd funded for a send whose inputs are
+// MuSig2 anchor outputs, together with the signing state of each of them.
+type Cosign struct {
+	AnchorPSBT string        `json:"anchor_psbt"`
+	Inputs     []CosignInput `json:"inputs"`
+	// Committed is what tapd needs to publish the transaction once signed
+	Committed *tapd.CommitVirtualPSBTsResponse `json:"-"`
+}
+
+// CosignInput is one anchor transaction input to be signed by the server
+// and the user together. Keys, nonces and the sighash are hex encoded.
+type CosignInput struct {
+	InputIndex int `json:"input_index"`
+	// InternalKey is the aggregate of ServerKey and the user's key
+	InternalKey string `json:"internal_key"`
+	ServerKey   string `json:"server_key"`
+	MerkleRoot  string `json:"merkle_root,omitempty"`
+	SighashHex  string `json:"sighash_hex"`
+	ServerNonce string `json:"server_nonce"`
+	UserNonce   string `json:"user_nonce,omitempty"`
+	// SignerSession is the server signer's MuSig2 session for the input
+	SignerSession string `json:"-"`
+}
+
+func (s *Session) clone() *Session {
+	c := *s
+	c.Recipients = append([]Recipient(nil), s.Recipients...)
+	c.Inputs = append([]tapd.PrevId(nil), s.Inputs...)
+	c.Sighashes = append([]InputSighash(nil), s.Sighashes...)
+	if s.Cosign != nil {
+		cosign := *s.Cosign
+		cosign.Inputs = append([]CosignInput(nil), s.Cosign.Inputs...)
+		c.Cosign = &cosign
+	}
+	return &c
+}
@@ -0,0 +1,323 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"tajfi-server/wallet/tapd"
+	"time"
+)
+
+var (
+	ErrSessionNotFound       = errors.New("send session not found")
+	ErrSessionBusy           = errors.New("send session is already being completed")
+	ErrSessionExpired        = errors.New("send session has expired")
+	ErrSessionNotSignable    = errors.New("send session is not awaiting a signature")
+	ErrSessionNotCancellable = errors.New("send session can no longer be cancelled")
+	ErrSessionNotCosignable  = errors.New("send session is not awaiting a cosignature")
+	ErrInvalidTransition     = errors.New("invalid send session state transition")
+)
+
+// Store keeps send sessions in memory, keyed by session ID. Sessions that
+// are still waiting on the user expire after ttl; sessions in a final state
+// are forgotten after retention.
+type Store struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	retention time.Duration
+	sessions  map[string]*Session
+	onExpire  func(*Session)
+	onFail    func(*Session)
+}
+
+func NewStore(ttl, retention time.Duration) *Store {
+	return &Store{
+		ttl:       ttl,
+		retention: retention,
+		sessions:  make(map[string]*Session),
+	}
+}
+
+// OnExpire sets a hook called with every expired session by RunExpiry. The
+// session is claimed for the hook, which must move it on or Unclaim it; an
+// unclaimed expired session is handed to the hook again on the next sweep.
+func (s *Store) OnExpire(hook func(*Session)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onExpire = hook
+}
+
+// OnFail sets a hook called by Fail with every session it moved to failed.
+func (s *Store) OnFail(hook func(*Session)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onFail = hook
+}
+
+// Create registers a new funded session for pubKey paying recipients from
+// inputs.
+func (s *Store) Create(pubKey, fundedPSBT string, recipients []Recipient, inputs []tapd.PrevId) (*Session, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	now := time.Now().UTC()
+	session := &Session{
+		ID:         hex.EncodeToString(id),
+		PubKey:     pubKey,
+		Status:     StatusFunded,
+		FundedPSBT: fundedPSBT,
+		Recipients: recipients,
+		Inputs:     inputs,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ExpiresAt:  now.Add(s.ttl),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.ID] = session
+	return session.clone(), nil
+}
+
+// Get returns a copy of the session with the given ID owned by pubKey.
+// Sessions belonging to someone else are reported as not found.
+func (s *Store) Get(id, pubKey string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.PubKey != pubKey {
+		return nil, ErrSessionNotFound
+	}
+	return session.clone(), nil
+}
+
+// Status returns the state of the session with the given ID, whoever owns
+// it.
+func (s *Store) Status(id string) (Status, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return "", false
+	}
+	return session.Status, true
+}
+
+// Pending returns copies of pubKey's sessions that may still be anchored.
+func (s *Store) Pending(pubKey string) []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []*Session
+	for _, session := range s.sessions {
+		if session.PubKey != pubKey {
+			continue
+		}
+		switch session.Status {
+		case StatusFunded, StatusAwaitingSignature, StatusSigned, StatusQueued, StatusAwaitingCosignature:
+			pending = append(pending, session.clone())
+		}
+	}
+	return pending
+}
+
+// Transition moves the session to status, applying update to it first if
+// given. Only the transitions in allowedTransitions are accepted.
+func (s *Store) Transition(id string, status Status, update func(*Session)) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if !session.Status.canTransitionTo(status) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, session.Status, status)
+	}
+
+	if update != nil {
+		update(session)
+	}
+	session.Status = status
+	session.UpdatedAt = time.Now().UTC()
+	if status.Final() {
+		session.busy = false
+	}
+
+	return session.clone(), nil
+}
+
+// Update applies update to the session without changing its state.
+func (s *Store) Update(id string, update func(*Session)) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	update(session)
+	session.UpdatedAt = time.Now().UTC()
+	return session.clone(), nil
+}
+
+// Fail moves the session to failed, recording reason, and passes it to the
+// OnFail hook.
+func (s *Store) Fail(id string, reason error) {
+	failed, err := s.Transition(id, StatusFailed, func(session *Session) {
+		session.Error = reason.Error()
+	})
+	if err != nil {
+		log.Printf("Failed to mark send session %s as failed: %v", id, err)
+		return
+	}
+
+	s.mu.Lock()
+	hook := s.onFail
+	s.mu.Unlock()
+	if hook != nil {
+		hook(failed)
+	}
+}
+
+// Claim reserves a session awaiting a signature for completion by pubKey, so
+// that concurrent /send/complete calls cannot both use it. The claim ends
+// when the session reaches a final state.
+func (s *Store) Claim(id, pubKey string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.PubKey != pubKey {
+		return nil, ErrSessionNotFound
+	}
+	if session.busy {
+		return nil, ErrSessionBusy
+	}
+	if session.Status == StatusExpired || (session.Status == StatusAwaitingSignature && time.Now().After(session.ExpiresAt)) {
+		return nil, ErrSessionExpired
+	}
+	if session.Status != StatusAwaitingSignature {
+		return nil, ErrSessionNotSignable
+	}
+
+	session.busy = true
+	return session.clone(), nil
+}
+
+// ClaimCosign reserves a session awaiting the user's MuSig2 nonces or
+// partial signatures for pubKey, so that they are handled one request at a
+// time. The claim ends when the session reaches a final state or Unclaim is
+// called.
+func (s *Store) ClaimCosign(id, pubKey string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.PubKey != pubKey {
+		return nil, ErrSessionNotFound
+	}
+	if session.busy {
+		return nil, ErrSessionBusy
+	}
+	if session.Status == StatusExpired || (session.Status == StatusAwaitingCosignature && time.Now().After(session.ExpiresAt)) {
+		return nil, ErrSessionExpired
+	}
+	if session.Status != StatusAwaitingCosignature {
+		return nil, ErrSessionNotCosignable
+	}
+
+	session.busy = true
+	return session.clone(), nil
+}
+
+// ClaimCancel reserves a session owned by pubKey for cancellation. Only
+// sessions still waiting on the user, or expired, can be cancelled. The claim
+// ends when the session is cancelled or Unclaim is called.
+func (s *Store) ClaimCancel(id, pubKey string) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || session.PubKey != pubKey {
+		return nil, ErrSessionNotFound
+	}
+	if session.busy {
+		return nil, ErrSessionBusy
+	}
+	if !session.Status.canTransitionTo(StatusCancelled) {
+		return nil, ErrSessionNotCancellable
+	}
+
+	session.busy = true
+	return session.clone(), nil
+}
+
+// Unclaim gives up a claim on a session without changing its state.
+func (s *Store) Unclaim(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[id]; ok {
+		session.busy = false
+	}
+}
+
+// RunExpiry expires stale sessions and forgets old final ones every
+// interval, passing expired sessions to the OnExpire hook. Expired sessions
+// are only forgotten without a hook, which must move them on first. It
+// blocks forever and is meant to be run in a goroutine.
+func (s *Store) RunExpiry(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		expired, hook := s.expire(now)
+		for _, session := range expired {
+			hook(session)
+		}
+	}
+}
+
+// expire updates sessions for the time now and returns the expired sessions
+// it claimed for the OnExpire hook, if one is set.
+func (s *Store) expire(now time.Time) ([]*Session, func(*Session)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []*Session
+	for id, session := range s.sessions {
+		switch {
+		case session.busy:
+		case session.Status == StatusExpired && s.onExpire != nil:
+			// Left over from a hook that could not finish; try again
+			session.busy = true
+			expired = append(expired, session.clone())
+		case session.Status.Final() || session.Status == StatusExpired:
+			if now.After(session.UpdatedAt.Add(s.retention)) {
+				delete(s.sessions, id)
+			}
+		case now.After(session.ExpiresAt) && session.Status.canTransitionTo(StatusExpired):
+			log.Printf("Send session %s expired in state %s", id, session.Status)
+			session.Status = StatusExpired
+			session.UpdatedAt = now.UTC()
+			if s.onExpire != nil {
+				session.busy = true
+				expired = append(expired, session.clone())
+			}
+		}
+	}
+
+	return expired, s.onExpire
+}
@@ -0,0 +1,64 @@
+package sessions
+
+import (
+	"errors"
+	"tajfi-server/wallet/tapd"
+	"testing"
+	"time"
+)
+
+var testInputs = []tapd.PrevId{{Outpoint: tapd.Outpoint{Txid: "aa", OutputIndex: 0}, AssetId: "asset", Amount: 10}}
+
+func TestFailPassesSessionToHook(t *testing.T) {
+	store := NewStore(time.Minute, time.Hour)
+	var failed []*Session
+	store.OnFail(func(s *Session) { failed = append(failed, s) })
+
+	session, err := store.Create("user", "psbt", nil, testInputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Fail(session.ID, errors.New("tapd is down"))
+	if len(failed) != 1 || failed[0].Status != StatusFailed || len(failed[0].Inputs) != 1 {
+		t.Fatalf("hook got %+v, want the failed session with its inputs", failed)
+	}
+
+	// A session that can no longer fail is not handed to the hook again
+	store.Fail(session.ID, errors.New("again"))
+	if len(failed) != 1 {
+		t.Fatalf("hook called %d times, want 1", len(failed))
+	}
+}
+
+func TestExpiredSessionsWaitForTheHook(t *testing.T) {
+	store := NewStore(time.Minute, time.Hour)
+	session, err := store.Create("user", "psbt", nil, testInputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expired []string
+	store.OnExpire(func(s *Session) { expired = append(expired, s.ID) })
+
+	// Past both the TTL and the retention, the session is still expired
+	// first and handed to the hook rather than forgotten
+	now := time.Now().Add(2 * time.Hour)
+	for i := 0; i < 2; i++ {
+		sessions, hook := store.expire(now)
+		for _, s := range sessions {
+			hook(s)
+			store.Unclaim(s.ID)
+		}
+	}
+	if len(expired) != 2 || expired[0] != session.ID {
+		t.Fatalf("hook got %v, want the session on every sweep until moved on", expired)
+	}
+
+	if _, err := store.Transition(session.ID, StatusCancelled, nil); err != nil {
+		t.Fatal(err)
+	}
+	store.expire(now.Add(2 * time.Hour))
+	if _, ok := store.Status(session.ID); ok {
+		t.Fatal("cancelled session was not forgotten after the retention")
+	}
+}
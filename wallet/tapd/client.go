@@ -8,12 +8,16 @@ import (
 type TapdClientInterface interface {
 	CallNewAddress(tapdHost, macaroon string, payload NewAddressPayload) (map[string]interface{}, error)
 	DecodeAddr(tapdHost, macaroon, address string) (*DecodeAddrResponse, error)
-	FundVirtualPSBT(tapdHost, macaroon, invoice string, inputs PrevIds) (fundedPsbt *FundVirtualPSBTResponse, err error)
+	FundVirtualPSBT(tapdHost, macaroon string, invoices []string, inputs PrevIds, firstOutput int) (fundedPsbt *FundVirtualPSBTResponse, err error)
+	RemoveUTXOLease(tapdHost, macaroon string, outpoint Outpoint) error
 	SignVirtualPSBT(tapdHost, macaroon, psbt string) (fundedPsbt *SignVirtualPSBTResponse, err error)
 	AnchorVirtualPSBT(params AnchorVirtualPSBTParams) (*AssetTransferResponse, error)
+	CommitVirtualPSBTs(params CommitVirtualPSBTsParams) (*CommitVirtualPSBTsResponse, error)
+	PublishAndLogTransfer(params PublishAndLogTransferParams) (*AssetTransferResponse, error)
 	GetBalances(tapdHost, macaroon string) (*WalletBalancesResponse, error)
 	GetTransfers(tapdHost, macaroon string) (transfers AssetTransfersResponse, err error)
 	GetUtxos(tapdHost, macaroon string) (*GetUtxosResponse, error)
+	PushProof(tapdHost, macaroon string, params PushProofParams) error
 	// Only used for demo mode
 	SendAssets(tapdHost, macaroon, invoice string) (fundedPsbt *FundVirtualPSBTResponse, err error)
 }
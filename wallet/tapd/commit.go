@@ -0,0 +1,140 @@
+package tapd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"tajfi-server/wallet/lnd"
+)
+
+type CommitVirtualPSBTsParams struct {
+	VirtualPSBTs []string
+	// AnchorTemplate is the base64 anchor transaction PSBT tapd adds its
+	// inputs, change and fee to
+	AnchorTemplate string
+	FeeRate        uint64 // sat/vB
+	TargetConf     int    // used when FeeRate is 0
+	TapdHost       string
+	Macaroon       string
+}
+
+// CommitVirtualPSBTsResponse is a funded anchor transaction that still has
+// to be signed, with everything needed to publish it afterwards.
+type CommitVirtualPSBTsResponse struct {
+	AnchorPSBT        string            `json:"anchor_psbt"`
+	VirtualPSBTs      []string          `json:"virtual_psbts"`
+	PassiveAssetPSBTs []string          `json:"passive_asset_psbts"`
+	ChangeOutputIndex int               `json:"change_output_index"`
+	LndLockedUtxos    []json.RawMessage `json:"lnd_locked_utxos"`
+}
+
+// LockedOutpoints returns the LND wallet outputs tapd leased to fund the
+// anchor transaction, to be released if it is never published.
+func (r *CommitVirtualPSBTsResponse) LockedOutpoints() []lnd.OutPoint {
+	outpoints := make([]lnd.OutPoint, 0, len(r.LndLockedUtxos))
+	for _, raw := range r.LndLockedUtxos {
+		var outpoint struct {
+			Txid        []byte `json:"txid"`
+			OutputIndex uint32 `json:"output_index"`
+		}
+		if err := json.Unmarshal(raw, &outpoint); err != nil {
+			continue
+		}
+		outpoints = append(outpoints, lnd.OutPoint{TxidBytes: outpoint.Txid, OutputIndex: outpoint.OutputIndex})
+	}
+	return outpoints
+}
+
+// CommitVirtualPSBTs has tapd commit signed vPSBTs to an anchor transaction
+// and fund it, without signing the anchor transaction's inputs. Call it
+// directly instead of AnchorVirtualPSBT when some of them are not LND's to
+// sign.
+func (c *tapdClient) CommitVirtualPSBTs(params CommitVirtualPSBTsParams) (*CommitVirtualPSBTsResponse, error) {
+	url := fmt.Sprintf("https://%s/v1/taproot-assets/wallet/virtual-psbt/commit", params.TapdHost)
+
+	payload := map[string]interface{}{
+		"virtual_psbts": params.VirtualPSBTs,
+		"anchor_psbt":   params.AnchorTemplate,
+		"add":           true,
+	}
+	if params.FeeRate > 0 {
+		payload["sat_per_vbyte"] = params.FeeRate
+	} else {
+		payload["target_conf"] = params.TargetConf
+	}
+	payloadBytes, _ := json.Marshal(payload)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Grpc-Metadata-macaroon", params.Macaroon)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tapd RPC error: %s", resp.Status)
+	}
+
+	var committed CommitVirtualPSBTsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&committed); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return &committed, nil
+}
+
+type PublishAndLogTransferParams struct {
+	// AnchorPSBT is the fully signed anchor transaction
+	AnchorPSBT string
+	Committed  CommitVirtualPSBTsResponse
+	TapdHost   string
+	Macaroon   string
+}
+
+// PublishAndLogTransfer has tapd broadcast a signed anchor transaction made
+// with CommitVirtualPSBTs and track the transfer like one it anchored itself.
+func (c *tapdClient) PublishAndLogTransfer(params PublishAndLogTransferParams) (*AssetTransferResponse, error) {
+	url := fmt.Sprintf("https://%s/v1/taproot-assets/wallet/virtual-psbt/log-transfer", params.TapdHost)
+
+	payload := map[string]interface{}{
+		"anchor_psbt":         params.AnchorPSBT,
+		"virtual_psbts":       params.Committed.VirtualPSBTs,
+		"passive_asset_psbts": params.Committed.PassiveAssetPSBTs,
+		"change_output_index": params.Committed.ChangeOutputIndex,
+		"lnd_locked_utxos":    params.Committed.LndLockedUtxos,
+	}
+	payloadBytes, _ := json.Marshal(payload)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Grpc-Metadata-macaroon", params.Macaroon)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tapd RPC error: %s", resp.Status)
+	}
+
+	var published struct {
+		Transfer AssetTransferResponse `json:"transfer"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&published); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	return &published.Transfer, nil
+}
@@ -0,0 +1,86 @@
+package tapd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	sighashFile   = "sighash.hex"
+	signatureFile = "signature.hex"
+)
+
+// SigHandoff serializes access to the sighash.hex and signature.hex files
+// through which the tajfi tapd fork hands virtual PSBT signing off to the
+// user. The fork only knows these two fixed paths, so every exchange with it
+// has to happen under one lock or concurrent sends would read each other's
+// sighash or sign with each other's signature.
+//
+// Both files hold one hex value per line, one line per vPSBT input in input
+// order, so a single-input send is a single line just like before.
+type SigHandoff struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func NewSigHandoff(dir string) *SigHandoff {
+	return &SigHandoff{dir: dir}
+}
+
+// Sighashes has tapd attempt to sign psbt without a signature on file, which
+// makes the fork write out the sighash of every input the user needs to sign.
+func (h *SigHandoff) Sighashes(client TapdClientInterface, tapdHost, macaroon, psbt string) ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Never let a leftover signature from an interrupted send be picked up
+	h.cleanup()
+	defer h.cleanup()
+
+	// The sign call is expected to fail, we only want the sighash file
+	_, _ = client.SignVirtualPSBT(tapdHost, macaroon, psbt)
+
+	data, err := os.ReadFile(h.path(sighashFile))
+	if err != nil {
+		return nil, fmt.Errorf("tapd did not produce a sighash: %w", err)
+	}
+
+	sighashes := strings.Fields(string(data))
+	if len(sighashes) == 0 {
+		return nil, fmt.Errorf("tapd wrote an empty sighash file")
+	}
+	return sighashes, nil
+}
+
+// Sign writes the per-input signatures, in input order, where the fork
+// expects them and has tapd sign psbt with them.
+func (h *SigHandoff) Sign(client TapdClientInterface, tapdHost, macaroon, psbt string, signatures []string) (*SignVirtualPSBTResponse, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.cleanup()
+	defer h.cleanup()
+
+	if err := os.WriteFile(h.path(signatureFile), []byte(strings.Join(signatures, "\n")), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write signature file: %w", err)
+	}
+
+	return client.SignVirtualPSBT(tapdHost, macaroon, psbt)
+}
+
+// cleanup removes both hand-off files. Callers must hold h.mu.
+func (h *SigHandoff) cleanup() {
+	for _, name := range []string{signatureFile, sighashFile} {
+		if err := os.Remove(h.path(name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to delete %s file: %v", name, err)
+		}
+	}
+}
+
+func (h *SigHandoff) path(name string) string {
+	return filepath.Join(h.dir, name)
+}
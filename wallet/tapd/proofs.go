@@ -0,0 +1,60 @@
+package tapd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Proof delivery states tapd reports for the outputs of a transfer.
+const (
+	ProofDeliveryNotApplicable = "PROOF_DELIVERY_STATUS_NOT_APPLICABLE"
+	ProofDeliveryComplete      = "PROOF_DELIVERY_STATUS_COMPLETE"
+	ProofDeliveryPending       = "PROOF_DELIVERY_STATUS_PENDING"
+)
+
+// PushProofParams identifies the proof of one transfer output and the
+// universe server to push it to.
+type PushProofParams struct {
+	AssetID   string
+	Outpoint  string // txid:vout of the output's anchor
+	ScriptKey string
+	Server    string // host:port of the universe server
+}
+
+// PushProof has tapd push the proof of a transfer output to a universe
+// server, from which receivers using it as their proof courier fetch it.
+func (c *tapdClient) PushProof(tapdHost, macaroon string, params PushProofParams) error {
+	txid, index, found := strings.Cut(params.Outpoint, ":")
+	if !found {
+		return fmt.Errorf("invalid outpoint %q", params.Outpoint)
+	}
+	url := fmt.Sprintf("https://%s/v1/taproot-assets/universe/proofs/push/%s/%s/%s/%s",
+		tapdHost, params.AssetID, txid, index, params.ScriptKey)
+
+	requestBody := map[string]interface{}{
+		"server": map[string]string{"host": params.Server},
+	}
+	payloadBytes, _ := json.Marshal(requestBody)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Grpc-Metadata-macaroon", macaroon)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tapd RPC error: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -8,11 +8,13 @@ import (
 	"tajfi-server/wallet/lnd"
 )
 
+// NewAddressPayload leaves ScriptKey and InternalKey to tapd's own wallet
+// when they are unset.
 type NewAddressPayload struct {
-	AssetID     string                  `json:"asset_id"`
-	Amt         int                     `json:"amt"`
-	ScriptKey   map[string]interface{}  `json:"script_key"`
-	InternalKey lnd.InternalKeyResponse `json:"internal_key"`
+	AssetID     string                   `json:"asset_id"`
+	Amt         int                      `json:"amt"`
+	ScriptKey   map[string]interface{}   `json:"script_key,omitempty"`
+	InternalKey *lnd.InternalKeyResponse `json:"internal_key,omitempty"`
 }
 
 // CallNewAddress sends the payload to the Tapd NewAddress RPC.
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"tajfi-server/wallet/lnd"
 )
 
 // DecodeAddrResponse represents the full decoded asset response from Tapd.
@@ -86,23 +87,30 @@ type Outpoint struct {
 }
 
 type PrevId struct {
-	Outpoint  Outpoint `json:"outpoint"`
-	AssetId   string   `json:"id"`
-	ScriptKey string   `json:"script_key"`
-	Amount    int      `json:"-"`
+	Outpoint    Outpoint `json:"outpoint"`
+	AssetId     string   `json:"id"`
+	ScriptKey   string   `json:"script_key"`
+	Amount      int      `json:"-"`
+	BlockHeight int      `json:"-"` // anchor confirmation height, 0 if unconfirmed
 }
 
-// FundVirtualPSBT sends a request to Tapd to fund a virtual PSBT using the invoice.
-func (c *tapdClient) FundVirtualPSBT(tapdHost, macaroon, invoice string, inputs PrevIds) (fundedPsbt *FundVirtualPSBTResponse, err error) {
+// FundVirtualPSBT sends a request to Tapd to fund a virtual PSBT paying every
+// invoice. The recipients are anchored in consecutive outputs starting at
+// firstOutput, followed by tapd's change.
+func (c *tapdClient) FundVirtualPSBT(tapdHost, macaroon string, invoices []string, inputs PrevIds, firstOutput int) (fundedPsbt *FundVirtualPSBTResponse, err error) {
 	url := fmt.Sprintf("https://%s/v1/taproot-assets/wallet/virtual-psbt/fund", tapdHost)
 
+	// Each recipient is mapped to its own anchor output index
+	recipients := make(map[string]int, len(invoices))
+	for i, invoice := range invoices {
+		recipients[invoice] = firstOutput + i
+	}
+
 	// Prepare the payload
 	requestBody := map[string]interface{}{
 		"raw": map[string]interface{}{
-			"recipients": map[string]int{
-				invoice: 0, // Use the invoice as the recipient
-			},
-			"inputs": inputs.Inputs,
+			"recipients": recipients,
+			"inputs":     inputs.Inputs,
 		},
 	}
 	log.Println("Request body: ", requestBody)
@@ -140,6 +148,36 @@ func (c *tapdClient) FundVirtualPSBT(tapdHost, macaroon, invoice string, inputs
 	return fundedPsbt, nil
 }
 
+// RemoveUTXOLease asks Tapd to release its lease on an anchor outpoint, so
+// the assets it holds can be spent by another vPSBT.
+func (c *tapdClient) RemoveUTXOLease(tapdHost, macaroon string, outpoint Outpoint) error {
+	url := fmt.Sprintf("https://%s/v1/taproot-assets/wallet/utxo-lease/delete", tapdHost)
+
+	requestBody := map[string]interface{}{
+		"outpoint": outpoint,
+	}
+	payloadBytes, _ := json.Marshal(requestBody)
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Grpc-Metadata-macaroon", macaroon)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tapd RPC error: %s", resp.Status)
+	}
+
+	return nil
+}
+
 type SignVirtualPSBTResponse struct {
 	SignedPSBT string `json:"signed_psbt"`
 }
@@ -185,43 +223,46 @@ func (c *tapdClient) SignVirtualPSBT(tapdHost, macaroon, psbt string) (fundedPsb
 // AnchorVirtualPSBTParams holds the parameters for the anchor request.
 type AnchorVirtualPSBTParams struct {
 	VirtualPSBTs []string // Raw bytes for virtual PSBTs
-	TapdHost     string
-	Macaroon     string
+	// AnchorTemplate is the base64 anchor transaction PSBT with an output
+	// for every anchor output the vPSBTs use, see AnchorTemplate
+	AnchorTemplate string
+	FeeRate        uint64 // sat/vB
+	TargetConf     int    // used when FeeRate is 0
+	TapdHost       string
+	Macaroon       string
+	LNDHost        string
+	LNDMacaroon    string
 }
 
+// AnchorVirtualPSBT anchors signed vPSBTs in a new on-chain transaction
+// paying FeeRate. tapd's anchor call takes no fee rate, so the vPSBTs are
+// committed to the anchor transaction, which LND then signs and tapd
+// publishes.
 func (c *tapdClient) AnchorVirtualPSBT(params AnchorVirtualPSBTParams) (*AssetTransferResponse, error) {
-	url := fmt.Sprintf("https://%s/v1/taproot-assets/wallet/virtual-psbt/anchor", params.TapdHost)
-
-	// Prepare the request payload
-	payload := map[string]interface{}{
-		"virtual_psbts": params.VirtualPSBTs,
-	}
-	payloadBytes, _ := json.Marshal(payload)
-
-	// Create the HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadBytes))
+	committed, err := c.CommitVirtualPSBTs(CommitVirtualPSBTsParams{
+		VirtualPSBTs:   params.VirtualPSBTs,
+		AnchorTemplate: params.AnchorTemplate,
+		FeeRate:        params.FeeRate,
+		TargetConf:     params.TargetConf,
+		TapdHost:       params.TapdHost,
+		Macaroon:       params.Macaroon,
+	})
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Grpc-Metadata-macaroon", params.Macaroon)
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	finalized, err := lnd.FinalizePsbt(params.LNDHost, params.LNDMacaroon, committed.AnchorPSBT)
 	if err != nil {
+		if releaseErr := lnd.ReleaseOutputs(params.LNDHost, params.LNDMacaroon, committed.LockedOutpoints()); releaseErr != nil {
+			log.Printf("Failed to release LND leases of anchor transaction: %v", releaseErr)
+		}
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("tapd RPC error: %s", resp.Status)
-	}
-
-	// Parse the response into the AssetTransferResponse struct
-	var assetTransfer AssetTransferResponse
-	err = json.NewDecoder(resp.Body).Decode(&assetTransfer)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
-	}
 
-	return &assetTransfer, nil
+	return c.PublishAndLogTransfer(PublishAndLogTransferParams{
+		AnchorPSBT: finalized.SignedPsbt,
+		Committed:  *committed,
+		TapdHost:   params.TapdHost,
+		Macaroon:   params.Macaroon,
+	})
 }
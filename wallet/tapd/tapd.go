@@ -27,6 +27,7 @@ type Anchor struct {
 
 type TransferOutput struct {
 	Anchor              Anchor `json:"anchor"`
+	AssetID             string `json:"asset_id"`
 	ScriptKey           string `json:"script_key"`
 	ScriptKeyIsLocal    bool   `json:"script_key_is_local"`
 	Amount              string `json:"amount"`
@@ -66,13 +67,22 @@ type AssetGenesis struct {
 // AssetBalance represents an individual asset's balance.
 type AssetBalance struct {
 	AssetGenesis       AssetGenesis `json:"asset_genesis"`
+	GroupKey           string       `json:"group_key,omitempty"`
 	Balance            string       `json:"balance"`
 	UnconfirmedBalance string       `json:"unconfirmed_balance,omitempty"`
 }
 
+// AssetGroupBalance is the balance summed over every asset ID in a group.
+type AssetGroupBalance struct {
+	GroupKey           string `json:"group_key"`
+	Balance            string `json:"balance"`
+	UnconfirmedBalance string `json:"unconfirmed_balance,omitempty"`
+}
+
 // WalletBalancesResponse represents the response structure for wallet balances.
 type WalletBalancesResponse struct {
-	AssetBalances map[string]AssetBalance `json:"asset_balances"`
+	AssetBalances      map[string]AssetBalance      `json:"asset_balances"`
+	AssetGroupBalances map[string]AssetGroupBalance `json:"asset_group_balances,omitempty"`
 }
 
 // GetBalances interacts with the tapd daemon to retrieve wallet balances.
@@ -106,15 +116,41 @@ func (c *tapdClient) GetBalances(tapdHost, macaroon string) (*WalletBalancesResp
 	return &balances, nil
 }
 
+// ChainAnchor describes where an asset is anchored on chain.
+type ChainAnchor struct {
+	AnchorOutpoint string `json:"anchor_outpoint"`
+	BlockHeight    int    `json:"block_height"`
+}
+
+// AssetGroup is set on assets issued into a group, such as re-issuable
+// tranches of the same asset.
+type AssetGroup struct {
+	RawGroupKey     string `json:"raw_group_key"`
+	TweakedGroupKey string `json:"tweaked_group_key"`
+}
+
 type Asset struct {
 	AssetGenesis AssetGenesis `json:"asset_genesis"`
 	Amount       string       `json:"amount"`
 	ScriptKey    string       `json:"script_key"`
+	ChainAnchor  ChainAnchor  `json:"chain_anchor"`
+	AssetGroup   *AssetGroup  `json:"asset_group,omitempty"`
+}
+
+// GroupKey returns the key of the asset's group, the same key tap addresses
+// carry, or "" for ungrouped assets.
+func (a Asset) GroupKey() string {
+	if a.AssetGroup == nil {
+		return ""
+	}
+	return a.AssetGroup.TweakedGroupKey
 }
 
 type ManagedUtxo struct {
 	Outpoint string  `json:"out_point"`
 	Assets   []Asset `json:"assets"`
+	// InternalKey is the base64 taproot internal key of the anchor output
+	InternalKey string `json:"internal_key"`
 }
 
 // WalletBalancesResponse represents the response structure for wallet balances.
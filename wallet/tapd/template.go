@@ -0,0 +1,61 @@
+package tapd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+)
+
+// templateOutputValue is the value of an anchor template's placeholder
+// outputs in sat, tapd sets the real ones.
+const templateOutputValue = 1000
+
+// AnchorTemplate returns the base64 PSBT tapd is asked to commit vPSBTs to:
+// a version 2 transaction without inputs and one placeholder taproot output
+// for each of the anchor outputs the vPSBTs use. Outputs no vPSBT uses must
+// be given a script in unused, which they pay instead.
+func AnchorTemplate(outputs int, unused map[int][]byte) string {
+	placeholder := append([]byte{0x51, 0x20}, make([]byte, 32)...)
+
+	var tx bytes.Buffer
+	binary.Write(&tx, binary.LittleEndian, int32(2))
+	tx.WriteByte(0) // no inputs, tapd adds them
+	writeVarInt(&tx, uint64(outputs))
+	for i := 0; i < outputs; i++ {
+		script, ok := unused[i]
+		if !ok {
+			script = placeholder
+		}
+		binary.Write(&tx, binary.LittleEndian, int64(templateOutputValue))
+		writeVarInt(&tx, uint64(len(script)))
+		tx.Write(script)
+	}
+	binary.Write(&tx, binary.LittleEndian, uint32(0))
+
+	var psbt bytes.Buffer
+	psbt.Write([]byte{0x70, 0x73, 0x62, 0x74, 0xff})
+	// The global map holds only the unsigned transaction
+	psbt.Write([]byte{0x01, 0x00})
+	writeVarInt(&psbt, uint64(tx.Len()))
+	psbt.Write(tx.Bytes())
+	psbt.WriteByte(0)
+	// One empty map per output
+	psbt.Write(make([]byte, outputs))
+	return base64.StdEncoding.EncodeToString(psbt.Bytes())
+}
+
+func writeVarInt(w *bytes.Buffer, n uint64) {
+	switch {
+	case n < 0xfd:
+		w.WriteByte(byte(n))
+	case n <= 0xffff:
+		w.WriteByte(0xfd)
+		binary.Write(w, binary.LittleEndian, uint16(n))
+	case n <= 0xffffffff:
+		w.WriteByte(0xfe)
+		binary.Write(w, binary.LittleEndian, uint32(n))
+	default:
+		w.WriteByte(0xff)
+		binary.Write(w, binary.LittleEndian, n)
+	}
+}
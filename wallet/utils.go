@@ -4,12 +4,13 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math/big"
-	"os"
 	"sort"
 	"strconv"
 	"strings"
+	"tajfi-server/auth"
+	"tajfi-server/wallet/scriptkeys"
+	"tajfi-server/wallet/sessions"
 	"tajfi-server/wallet/tapd"
 
 	btcec "github.com/btcsuite/btcd/btcec/v2"
@@ -53,42 +54,77 @@ func CompressPubKey(pubKeyHex string) (string, error) {
 	return hex.EncodeToString(compressedKey), nil
 }
 
-// Helper function to read the override signature or sighash from a file.
-func ReadFile(filename string) (string, error) {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// If the file doesn't exist, return an empty string.
-			return "", nil
-		}
-		return "", err
+// verifySighashSignature checks that signatureHex is a valid BIP-340
+// signature by the x-only pubKey over the 32-byte sighashHex.
+func verifySighashSignature(sighashHex, pubKey, signatureHex string) error {
+	sighash, err := hex.DecodeString(sighashHex)
+	if err != nil || len(sighash) != 32 {
+		return errors.New("session has no valid sighash to verify against")
 	}
-	return string(data), nil
+
+	return auth.VerifyDigest(pubKey, sighash, signatureHex)
 }
 
-// Save sigHash to a file named sighash.hex, clearing any previous contents.
-func WriteSignatureToFile(filename string, signatureHex string) error {
-	// Open the file with write-only mode, create it if it doesn't exist, and truncate it to clear existing content.
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open/create file: %w", err)
+// verifyInputSignatures checks there is exactly one valid signature for each
+// sighash and returns the signatures in input order. Inputs at a script key
+// derived from pubKey are signed for by that key.
+func verifyInputSignatures(sighashes []sessions.InputSighash, pubKey string, signatures []InputSignature) ([]string, error) {
+	if len(signatures) != len(sighashes) {
+		return nil, fmt.Errorf("expected %d signatures, got %d", len(sighashes), len(signatures))
 	}
-	defer file.Close()
 
-	// Write the sigHash as a hex string to the file.
-	_, err = file.WriteString(signatureHex)
-	if err != nil {
-		return fmt.Errorf("failed to write to file: %w", err)
+	ordered := make([]string, len(sighashes))
+	for _, sig := range signatures {
+		if sig.InputIndex < 0 || sig.InputIndex >= len(sighashes) {
+			return nil, fmt.Errorf("no input with index %d", sig.InputIndex)
+		}
+		if ordered[sig.InputIndex] != "" {
+			return nil, fmt.Errorf("duplicate signature for input %d", sig.InputIndex)
+		}
+		signer := pubKey
+		if sighashes[sig.InputIndex].ScriptKey != "" {
+			signer = sighashes[sig.InputIndex].ScriptKey
+		}
+		if err := verifySighashSignature(sighashes[sig.InputIndex].SighashHex, signer, sig.SignatureHex); err != nil {
+			return nil, fmt.Errorf("signature for input %d does not match its sighash: %w", sig.InputIndex, err)
+		}
+		ordered[sig.InputIndex] = sig.SignatureHex
+	}
+
+	return ordered, nil
+}
+
+// tagSighashes pairs the sighashes written by tapd with the inputs the vPSBT
+// was funded with, which tapd keeps in the order they were given. Inputs at
+// a derived script key carry what the user needs to sign for it.
+func tagSighashes(sighashes []string, inputs []tapd.PrevId, scriptKeys *scriptkeys.Store) ([]sessions.InputSighash, error) {
+	if len(sighashes) != len(inputs) {
+		return nil, fmt.Errorf("tapd returned %d sighashes for %d inputs", len(sighashes), len(inputs))
 	}
 
-	fmt.Println("Signature successfully written to " + filename)
-	return nil
+	tagged := make([]sessions.InputSighash, len(sighashes))
+	for i, sighash := range sighashes {
+		tagged[i] = sessions.InputSighash{
+			InputIndex: i,
+			Outpoint:   fmt.Sprintf("%s:%d", inputs[i].Outpoint.Txid, inputs[i].Outpoint.OutputIndex),
+			SighashHex: sighash,
+		}
+		if key, ok := scriptKeys.Get(inputs[i].ScriptKey); ok {
+			tagged[i].ScriptKey = key.XOnly()
+			tagged[i].KeyTweak = key.Tweak
+		}
+	}
+	return tagged, nil
 }
 
-func FilterOwnedUtxos(utxos *tapd.GetUtxosResponse, pubKey string, assetId string) (ownedUtxos tapd.PrevIds) {
+// FilterOwnedUtxos returns every asset of pubKey matching filter as an
+// input, at the user's own key or one derived for them. An anchor output can
+// hold several of them, such as one at each of those keys, and each is its
+// own input.
+func FilterOwnedUtxos(utxos *tapd.GetUtxosResponse, pubKey string, filter AssetFilter, scriptKeys *scriptkeys.Store) (ownedUtxos tapd.PrevIds) {
 	for _, utxo := range utxos.ManagedUtxos {
 		for _, asset := range utxo.Assets {
-			if asset.ScriptKey == ("02"+pubKey) && asset.AssetGenesis.AssetID == assetId {
+			if scriptKeys.Owns(pubKey, asset.ScriptKey) && filter.Matches(asset) {
 				txid, vout, err := parseOutPoint(utxo.Outpoint)
 				if err != nil {
 					fmt.Println("Error parsing outpoint:", err)
@@ -100,12 +136,12 @@ func FilterOwnedUtxos(utxos *tapd.GetUtxosResponse, pubKey string, assetId strin
 					continue
 				}
 				ownedUtxos.Inputs = append(ownedUtxos.Inputs, tapd.PrevId{
-					Outpoint:  tapd.Outpoint{Txid: txid, OutputIndex: vout},
-					AssetId:   asset.AssetGenesis.AssetID,
-					ScriptKey: asset.ScriptKey,
-					Amount:    amount,
+					Outpoint:    tapd.Outpoint{Txid: txid, OutputIndex: vout},
+					AssetId:     asset.AssetGenesis.AssetID,
+					ScriptKey:   asset.ScriptKey,
+					Amount:      amount,
+					BlockHeight: asset.ChainAnchor.BlockHeight,
 				})
-				break
 			}
 		}
 	}